@@ -0,0 +1,297 @@
+package main
+
+/**
+ * AWS profile, region and credential expiry, read from the environment and ~/.aws without the CLI
+ */
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/fatih/color"
+)
+
+type AWSInfo struct {
+	Profile string
+	Region  string
+
+	// Zero if we couldn't find out when the credentials expire
+	Expiration time.Time
+}
+
+func firstEnv(names ...string) string {
+	for _, name := range names {
+		if value := os.Getenv(name); len(value) > 0 {
+			return value
+		}
+	}
+
+	return ""
+}
+
+func awsConfigPath() string {
+	if path := os.Getenv("AWS_CONFIG_FILE"); len(path) > 0 {
+		return path
+	}
+
+	return filepath.Join(HOME, ".aws/config")
+}
+
+func awsCredentialsPath() string {
+	if path := os.Getenv("AWS_SHARED_CREDENTIALS_FILE"); len(path) > 0 {
+		return path
+	}
+
+	return filepath.Join(HOME, ".aws/credentials")
+}
+
+/**
+ * AWS writes timestamps a few different ways depending on the tool and version.
+ */
+func parseAWSTime(str string) (time.Time, bool) {
+	formats := []string{
+		time.RFC3339,
+		"2006-01-02T15:04:05UTC",
+		"2006-01-02T15:04:05Z0700",
+		"2006-01-02 15:04:05-07:00",
+	}
+
+	str = strings.TrimSpace(str)
+
+	for _, format := range formats {
+		if t, err := time.Parse(format, str); err == nil {
+			return t, true
+		}
+	}
+
+	return time.Time{}, false
+}
+
+/**
+ * Expiry of the SSO token for a profile, from ~/.aws/sso/cache.  The cache file is named after the
+ * SHA1 of the sso-session name (or the start URL, for older configs).
+ */
+func awsSSOExpiration(profile map[string]string) (time.Time, bool) {
+	cacheKey := ""
+
+	if session, ok := profile["sso_session"]; ok {
+		cacheKey = session
+	} else if startURL, ok := profile["sso_start_url"]; ok {
+		cacheKey = startURL
+	} else {
+		return time.Time{}, false
+	}
+
+	hash := sha1.Sum([]byte(cacheKey))
+	path := filepath.Join(HOME, ".aws/sso/cache", hex.EncodeToString(hash[:])+".json")
+
+	content, err := ioutil.ReadFile(path)
+	if err != nil {
+		return time.Time{}, false
+	}
+
+	var token struct {
+		ExpiresAt string `json:"expiresAt"`
+	}
+
+	if json.Unmarshal(content, &token) != nil {
+		return time.Time{}, false
+	}
+
+	return parseAWSTime(token.ExpiresAt)
+}
+
+/**
+ * Expiry of the credentials the CLI cached in ~/.aws/cli/cache for a profile.  Assumed role
+ * credentials are matched on the role's account and name; SSO role credentials are cached under the
+ * SHA1 of the account, role and start URL.  If there are several matches, the latest wins.
+ */
+func awsCLICacheExpiration(profile map[string]string) (time.Time, bool) {
+	var latest time.Time
+
+	if profile == nil {
+		return latest, false
+	}
+
+	ssoKey := ""
+	if accountID, ok := profile["sso_account_id"]; ok {
+		key := map[string]string{
+			"accountId": accountID,
+			"roleName":  profile["sso_role_name"],
+			"startUrl":  profile["sso_start_url"],
+		}
+
+		if session, ok := profile["sso_session"]; ok {
+			key["sessionName"] = session
+		}
+
+		// Go sorts map keys, like the CLI does
+		if encoded, err := json.Marshal(key); err == nil {
+			hash := sha1.Sum(encoded)
+			ssoKey = hex.EncodeToString(hash[:])
+		}
+	}
+
+	// arn:aws:iam::123456789012:role/path/name -> 123456789012, name
+	roleAccount, roleName := "", ""
+	if arn := strings.Split(profile["role_arn"], ":"); len(arn) == 6 {
+		roleAccount = arn[4]
+		roleName = arn[5][strings.LastIndex(arn[5], "/")+1:]
+	}
+
+	paths, _ := filepath.Glob(filepath.Join(HOME, ".aws/cli/cache", "*.json"))
+
+	for _, path := range paths {
+		content, err := ioutil.ReadFile(path)
+		if err != nil {
+			continue
+		}
+
+		var cached struct {
+			Credentials struct {
+				Expiration string
+			}
+			AssumedRoleUser struct {
+				Arn string
+			}
+		}
+
+		if json.Unmarshal(content, &cached) != nil {
+			continue
+		}
+
+		matches := len(ssoKey) > 0 && strings.TrimSuffix(filepath.Base(path), ".json") == ssoKey
+
+		// arn:aws:sts::123456789012:assumed-role/name/session
+		if arn := strings.Split(cached.AssumedRoleUser.Arn, ":"); len(roleName) > 0 && len(arn) == 6 {
+			parts := strings.Split(arn[5], "/")
+			matches = matches || (arn[4] == roleAccount && len(parts) >= 2 && parts[1] == roleName)
+		}
+
+		if !matches {
+			continue
+		}
+
+		if expiration, ok := parseAWSTime(cached.Credentials.Expiration); ok && expiration.After(latest) {
+			latest = expiration
+		}
+	}
+
+	return latest, !latest.IsZero()
+}
+
+/**
+ * Expiry of temporary credentials, from the places credential helpers (aws-vault, saml2aws, ...) and
+ * the CLI leave it.
+ */
+func awsCredentialExpiration(profileName string, profile map[string]string) (time.Time, bool) {
+	if env := firstEnv("AWS_CREDENTIAL_EXPIRATION", "AWS_SESSION_EXPIRATION"); len(env) > 0 {
+		return parseAWSTime(env)
+	}
+
+	credentials := readINIFile(awsCredentialsPath())
+	if section, ok := credentials[profileName]; ok {
+		for _, key := range []string{"expiration", "aws_expiration", "x_security_token_expires"} {
+			if value, ok := section[key]; ok {
+				return parseAWSTime(value)
+			}
+		}
+	}
+
+	return awsCLICacheExpiration(profile)
+}
+
+/**
+ * Loads AWS info, or nil if no profile or region has been picked in the environment.
+ */
+func NewAWSInfo() *AWSInfo {
+	info := &AWSInfo{
+		Profile: firstEnv("AWS_PROFILE", "AWS_DEFAULT_PROFILE"),
+		Region:  firstEnv("AWS_REGION", "AWS_DEFAULT_REGION"),
+	}
+
+	if len(info.Profile) == 0 && len(info.Region) == 0 {
+		return nil
+	}
+
+	profileName := info.Profile
+	if len(profileName) == 0 {
+		profileName = "default"
+	}
+
+	config := readINIFile(awsConfigPath())
+
+	// The default profile is "[default]", everything else is "[profile name]"
+	profile := config["profile "+profileName]
+	if profileName == "default" {
+		profile = config["default"]
+	}
+
+	if profile != nil {
+		if len(info.Region) == 0 {
+			info.Region = profile["region"]
+		}
+
+		if session, ok := profile["sso_session"]; ok {
+			// Newer configs keep the SSO settings in their own section
+			for key, value := range config["sso-session "+session] {
+				if _, exists := profile[key]; !exists {
+					profile[key] = value
+				}
+			}
+		}
+
+		if expiration, ok := awsSSOExpiration(profile); ok {
+			info.Expiration = expiration
+		}
+	}
+
+	if info.Expiration.IsZero() {
+		if expiration, ok := awsCredentialExpiration(profileName, profile); ok {
+			info.Expiration = expiration
+		}
+	}
+
+	return info
+}
+
+var AWS_INFO *AWSInfo
+var AWS_INFO_LOADED bool
+
+/**
+ * AWS info for this prompt, loaded once since both the segment and the credential check need it.
+ */
+func currentAWSInfo() *AWSInfo {
+	if !AWS_INFO_LOADED {
+		AWS_INFO = NewAWSInfo()
+		AWS_INFO_LOADED = true
+	}
+
+	return AWS_INFO
+}
+
+func awsProfile() (string, string) {
+	info := currentAWSInfo()
+
+	if info == nil {
+		return "", ""
+	}
+
+	str := "aws:" + info.Profile
+	if len(info.Profile) > 0 && len(info.Region) > 0 {
+		str += "/"
+	}
+	str += info.Region
+
+	if isProduction(info.Profile) {
+		return str, themeColor("aws-production", color.BgRed, color.FgHiWhite, color.Bold).Sprint(str)
+	} else {
+		return str, themeColor("aws", color.FgHiYellow).Sprint(str)
+	}
+}
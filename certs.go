@@ -0,0 +1,201 @@
+package main
+
+/**
+ * Watches certificate and cookie files on disk for upcoming expiry
+ */
+
+import (
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"io/ioutil"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var ErrNoExpiry = errors.New("no expiry found")
+
+/**
+ * Earliest NotAfter of the certificates in PEM data.
+ */
+func pemExpiry(content []byte) (time.Time, error) {
+	var earliest time.Time
+
+	for {
+		var block *pem.Block
+		block, content = pem.Decode(content)
+
+		if block == nil {
+			break
+		}
+
+		if block.Type != "CERTIFICATE" {
+			continue
+		}
+
+		cert, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			return time.Time{}, err
+		}
+
+		if earliest.IsZero() || cert.NotAfter.Before(earliest) {
+			earliest = cert.NotAfter
+		}
+	}
+
+	if earliest.IsZero() {
+		return earliest, ErrNoExpiry
+	}
+
+	return earliest, nil
+}
+
+/**
+ * Earliest expiry of the cookies in a Netscape/curl cookie jar, optionally only the named cookie.
+ * Session cookies (no expiry) are ignored.
+ */
+func cookieExpiry(content []byte, name string) (time.Time, error) {
+	var earliest time.Time
+
+	for _, line := range strings.Split(string(content), "\n") {
+		line = strings.TrimSpace(line)
+
+		// curl marks HttpOnly cookies with a prefix that looks like a comment
+		line = strings.TrimPrefix(line, "#HttpOnly_")
+
+		if len(line) <= 0 || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		// domain, include subdomains, path, secure, expiry, name, value
+		fields := strings.Split(line, "\t")
+		if len(fields) < 7 {
+			continue
+		}
+
+		if len(name) > 0 && fields[5] != name {
+			continue
+		}
+
+		seconds, err := strconv.ParseInt(fields[4], 10, 64)
+		if err != nil || seconds == 0 {
+			continue
+		}
+
+		expires := time.Unix(seconds, 0)
+		if earliest.IsZero() || expires.Before(earliest) {
+			earliest = expires
+		}
+	}
+
+	if earliest.IsZero() {
+		return earliest, ErrNoExpiry
+	}
+
+	return earliest, nil
+}
+
+/**
+ * Parses durations with days as well ("7d"), since certificate warnings tend to be long.
+ */
+func parseLongDuration(str string) (time.Duration, error) {
+	if strings.HasSuffix(str, "d") {
+		days, err := strconv.Atoi(strings.TrimSuffix(str, "d"))
+		if err != nil {
+			return 0, err
+		}
+
+		return time.Duration(days) * 24 * time.Hour, nil
+	}
+
+	return time.ParseDuration(str)
+}
+
+/**
+ * A PEM certificate or cookie jar, expiring at the earliest certificate NotAfter or cookie expiry.
+ */
+type CertFileCheck struct {
+	Label string
+	Path  string
+
+	// Only look at this cookie (cookie jars only)
+	Cookie string
+
+	// Warn this long before expiry, or CREDENTIAL_WARNING if zero
+	Warning time.Duration
+}
+
+func (c CertFileCheck) Check() CredentialStatus {
+	content, err := ioutil.ReadFile(c.Path)
+	if err != nil {
+		// File is gone
+		return CredentialStatus{Label: c.Label, State: CREDENTIAL_EXPIRED}
+	}
+
+	var expires time.Time
+
+	if strings.Contains(string(content), "-----BEGIN ") {
+		expires, err = pemExpiry(content)
+	} else {
+		expires, err = cookieExpiry(content, c.Cookie)
+	}
+
+	if err != nil {
+		return CredentialStatus{Label: c.Label, State: CREDENTIAL_UNKNOWN}
+	}
+
+	warning := c.Warning
+	if warning <= 0 {
+		warning = CREDENTIAL_WARNING
+	}
+
+	return credentialStatusFromExpiryWithin(c.Label, expires, warning)
+}
+
+/**
+ * Cert files to watch, from ~/.host/config/check_certs.  Each line is:
+ *
+ *   label = path[, warn=7d][, cookie=name]
+ *
+ * Paths can use ~ and globs, with each matching file checked separately.
+ */
+func certFileChecks() []CredentialCheck {
+	checks := make([]CredentialCheck, 0)
+
+	for _, pair := range readHostConfigPairs("check_certs") {
+		options := strings.Split(pair[1], ",")
+
+		check := CertFileCheck{Label: pair[0]}
+
+		for _, option := range options[1:] {
+			parts := strings.SplitN(strings.TrimSpace(option), "=", 2)
+			if len(parts) != 2 {
+				continue
+			}
+
+			switch parts[0] {
+			case "warn":
+				check.Warning, _ = parseLongDuration(parts[1])
+			case "cookie":
+				check.Cookie = parts[1]
+			}
+		}
+
+		path := expandHome(strings.TrimSpace(options[0]))
+
+		matches, err := filepath.Glob(path)
+		if err != nil || len(matches) == 0 {
+			// Checking the missing file flags it
+			matches = []string{path}
+		}
+
+		for _, match := range matches {
+			check.Path = match
+			checks = append(checks, check)
+		}
+	}
+
+	return checks
+}
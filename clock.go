@@ -0,0 +1,213 @@
+package main
+
+/**
+ * The clock: format, UTC and extra time zones, set in ~/.host/config/clock
+ */
+
+import (
+	"log"
+	"strings"
+	"time"
+
+	"github.com/fatih/color"
+)
+
+// The current time, replaced in tests so the prompt is predictable
+var NOW = time.Now
+
+// Named formats, anything else is a strftime style format
+var CLOCK_FORMATS = map[string]string{
+	"24h":         "%H:%M",
+	"24h-seconds": "%H:%M:%S",
+	"12h":         "%l:%M%P",
+	"12h-seconds": "%l:%M:%S%P",
+	"date":        "%a %d %b %H:%M",
+}
+
+// strftime conversions and their Go layouts
+var STRFTIME_LAYOUTS = map[byte]string{
+	'H': "15",
+	'I': "03",
+	'l': "3",
+	'M': "04",
+	'S': "05",
+	'p': "PM",
+	'P': "pm",
+	'Y': "2006",
+	'y': "06",
+	'm': "01",
+	'd': "02",
+	'e': "_2",
+	'a': "Mon",
+	'A': "Monday",
+	'b': "Jan",
+	'B': "January",
+	'Z': "MST",
+	'z': "-0700",
+}
+
+type ClockZone struct {
+	Label    string
+	Location *time.Location
+}
+
+type ClockSettings struct {
+	Format string
+
+	// Show the main clock in UTC instead of local time
+	UTC bool
+
+	// Show the main clock at all, you might only want the zones
+	Local bool
+
+	Zones []ClockZone
+}
+
+/**
+ * Formats a time with strftime conversions (%H:%M).  Each conversion is formatted on its own, so
+ * the rest of the format is left alone even if it looks like a Go layout.
+ */
+func strftime(t time.Time, format string) string {
+	var result strings.Builder
+
+	for i := 0; i < len(format); i++ {
+		if format[i] != '%' || i+1 >= len(format) {
+			result.WriteByte(format[i])
+			continue
+		}
+
+		i++
+
+		if layout, ok := STRFTIME_LAYOUTS[format[i]]; ok {
+			result.WriteString(t.Format(layout))
+		} else if format[i] == '%' {
+			result.WriteByte('%')
+		} else {
+			// Unknown, leave it be
+			result.WriteByte('%')
+			result.WriteByte(format[i])
+		}
+	}
+
+	return result.String()
+}
+
+func parseBool(str string) bool {
+	switch strings.ToLower(str) {
+	case "true", "yes", "on", "1":
+		return true
+	}
+
+	return false
+}
+
+/**
+ * Clock settings from ~/.host/config/clock, "key = value" per line:
+ *
+ *   format = 24h                  24h, 24h-seconds, 12h, 12h-seconds, date, or strftime (%H:%M)
+ *   utc = true                    Main clock in UTC
+ *   local = false                 Hide the main clock
+ *   zone = SEA America/Los_Angeles
+ *
+ *   [transient]                   Only for this line: prompt, right or transient
+ *   format = 24h-seconds
+ *
+ * Zones can be repeated, and are shown after the main clock in order.  Zones in a line's section
+ * replace the ones above.
+ */
+func clockSettings(line string) ClockSettings {
+	settings := ClockSettings{Format: CLOCK_FORMATS["24h"], Local: true}
+
+	section := ""
+	sectionZones := false
+
+	for _, config := range readHostConfigLines("clock") {
+		if strings.HasPrefix(config, "[") && strings.HasSuffix(config, "]") {
+			section = strings.TrimSpace(config[1 : len(config)-1])
+			continue
+		}
+
+		if section != "" && section != line {
+			continue
+		}
+
+		parts := strings.SplitN(config, "=", 2)
+		if len(parts) != 2 {
+			log.Printf("Ignoring malformed line in clock: %v", config)
+			continue
+		}
+
+		key, value := strings.TrimSpace(parts[0]), strings.TrimSpace(parts[1])
+
+		switch key {
+		case "format":
+			if format, ok := CLOCK_FORMATS[value]; ok {
+				settings.Format = format
+			} else {
+				settings.Format = value
+			}
+		case "utc":
+			settings.UTC = parseBool(value)
+		case "local":
+			settings.Local = parseBool(value)
+		case "zone":
+			fields := strings.Fields(value)
+			if len(fields) != 2 {
+				log.Printf("Ignoring malformed clock zone: %v", value)
+				continue
+			}
+
+			location, err := time.LoadLocation(fields[1])
+			if err != nil {
+				log.Printf("Ignoring unknown time zone (%v): %v", fields[1], err)
+				continue
+			}
+
+			if section != "" && !sectionZones {
+				settings.Zones = nil
+				sectionZones = true
+			}
+
+			settings.Zones = append(settings.Zones, ClockZone{Label: fields[0], Location: location})
+		default:
+			log.Printf("Ignoring unknown clock setting: %v", key)
+		}
+	}
+
+	return settings
+}
+
+/**
+ * e.g. "14:12" or "14:12 | SEA 09:12 | DUB 17:12".
+ */
+func clock(settings ClockSettings) (string, string) {
+	now := NOW()
+
+	plain := make([]string, 0)
+	colored := make([]string, 0)
+
+	if settings.Local {
+		t := now.Local()
+		if settings.UTC {
+			t = now.UTC()
+		}
+
+		str := strings.TrimSpace(strftime(t, settings.Format))
+
+		plain = append(plain, str)
+		colored = append(colored, themeColor("time", color.FgYellow).Sprint(str))
+	}
+
+	for _, zone := range settings.Zones {
+		label := zone.Label + " "
+		str := strings.TrimSpace(strftime(now.In(zone.Location), settings.Format))
+
+		plain = append(plain, label+str)
+		colored = append(colored, themeColor("time-zone-label", color.FgHiBlack).Sprint(label)+
+			themeColor("time-zone", color.FgYellow).Sprint(str))
+	}
+
+	separator := themeColor("time-zone-label", color.FgHiBlack).Sprint(" | ")
+
+	return strings.Join(plain, " | "), strings.Join(colored, separator)
+}
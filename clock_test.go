@@ -0,0 +1,164 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/fatih/color"
+)
+
+/**
+ * Points HOME at a temporary directory with the given clock config, and stops the clock at
+ * 2023-11-14 16:05:09 UTC.  Returns a function that puts everything back.
+ */
+func setupClock(t *testing.T, config string) func() {
+	dir, err := ioutil.TempDir("", "clock")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := os.MkdirAll(filepath.Join(dir, ".host/config"), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := ioutil.WriteFile(filepath.Join(dir, ".host/config/clock"), []byte(config), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	home, now, local, noColor := HOME, NOW, time.Local, color.NoColor
+
+	HOME = dir
+	NOW = func() time.Time { return time.Date(2023, 11, 14, 16, 5, 9, 0, time.UTC) }
+	time.Local = time.UTC
+	color.NoColor = true
+
+	return func() {
+		HOME, NOW, time.Local, color.NoColor = home, now, local, noColor
+		os.RemoveAll(dir)
+	}
+}
+
+func TestStrftime(t *testing.T) {
+	moment := time.Date(2023, 11, 4, 9, 5, 7, 0, time.UTC)
+
+	tests := map[string]string{
+		"%H:%M":          "09:05",
+		"%H:%M:%S":       "09:05:07",
+		"%l:%M%P":        "9:05am",
+		"%I:%M %p":       "09:05 AM",
+		"%a %d %b %H:%M": "Sat 04 Nov 09:05",
+		"%A %e %B %Y":    "Saturday  4 November 2023",
+		"%y-%m-%d %Z %z": "23-11-04 UTC +0000",
+		"100%% at %H":    "100% at 09",
+		"%q is unknown":  "%q is unknown",
+		"trailing %":     "trailing %",
+		// Go layout numbers in the literal text are left alone
+		"2006 %H": "2006 09",
+	}
+
+	for format, expected := range tests {
+		if actual := strftime(moment, format); actual != expected {
+			t.Errorf("%q: got %q, expected %q", format, actual, expected)
+		}
+	}
+}
+
+func TestClockFormats(t *testing.T) {
+	tests := []struct {
+		config   string
+		expected string
+	}{
+		{"", "16:05"},
+		{"format = 24h-seconds", "16:05:09"},
+		{"format = 12h", "4:05pm"},
+		{"format = 12h-seconds", "4:05:09pm"},
+		{"format = date", "Tue 14 Nov 16:05"},
+		{"format = %H.%M", "16.05"},
+	}
+
+	for _, test := range tests {
+		restore := setupClock(t, test.config)
+
+		if actual, _ := clock(clockSettings("prompt")); actual != test.expected {
+			t.Errorf("%q: got %q, expected %q", test.config, actual, test.expected)
+		}
+
+		restore()
+	}
+}
+
+func TestClockUTC(t *testing.T) {
+	defer setupClock(t, "utc = true")()
+
+	// Local time is somewhere else, the clock should ignore it
+	location, err := time.LoadLocation("Asia/Tokyo")
+	if err != nil {
+		t.Skip("No time zone database:", err)
+	}
+	time.Local = location
+
+	if actual, _ := clock(clockSettings("prompt")); actual != "16:05" {
+		t.Errorf("Got %q in UTC", actual)
+	}
+
+	if actual, _ := clock(ClockSettings{Format: "%H:%M", Local: true}); actual != "01:05" {
+		t.Errorf("Got %q in local time", actual)
+	}
+}
+
+func TestClockZones(t *testing.T) {
+	defer setupClock(t, "zone = SEA America/Los_Angeles\nzone = DUB Europe/Dublin\n")()
+
+	if _, err := time.LoadLocation("America/Los_Angeles"); err != nil {
+		t.Skip("No time zone database:", err)
+	}
+
+	settings := clockSettings("prompt")
+
+	if actual := len(settings.Zones); actual != 2 {
+		t.Fatalf("Got %d zones, expected 2", actual)
+	}
+
+	if actual, _ := clock(settings); actual != "16:05 | SEA 08:05 | DUB 16:05" {
+		t.Errorf("Got %q", actual)
+	}
+
+	settings.Local = false
+
+	if actual, _ := clock(settings); actual != "SEA 08:05 | DUB 16:05" {
+		t.Errorf("Got %q without the main clock", actual)
+	}
+}
+
+func TestClockPerLine(t *testing.T) {
+	config := `format = 12h
+zone = SEA America/Los_Angeles
+
+[transient]
+format = 24h-seconds
+zone = UTC UTC
+
+[right]
+local = false
+`
+	defer setupClock(t, config)()
+
+	if _, err := time.LoadLocation("America/Los_Angeles"); err != nil {
+		t.Skip("No time zone database:", err)
+	}
+
+	tests := map[string]string{
+		"prompt":    "4:05pm | SEA 8:05am",
+		"transient": "16:05:09 | UTC 16:05:09",
+		"right":     "SEA 8:05am",
+	}
+
+	for line, expected := range tests {
+		if actual, _ := clock(clockSettings(line)); actual != expected {
+			t.Errorf("%v: got %q, expected %q", line, actual, expected)
+		}
+	}
+}
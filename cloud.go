@@ -0,0 +1,125 @@
+package main
+
+/**
+ * Terraform workspace, and optionally the active GCP and Azure accounts, read from their state files
+ */
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/fatih/color"
+)
+
+/**
+ * The selected workspace when we're in a Terraform directory, or empty.
+ */
+func terraformWorkspace() string {
+	if WORKING_DIRECTORY == "" {
+		return ""
+	}
+
+	dataDir := firstNonEmpty(os.Getenv("TF_DATA_DIR"), ".terraform")
+	if !filepath.IsAbs(dataDir) {
+		dataDir = filepath.Join(WORKING_DIRECTORY, dataDir)
+	}
+
+	configs, _ := filepath.Glob(filepath.Join(WORKING_DIRECTORY, "*.tf"))
+
+	if !fileExists(dataDir) && len(configs) == 0 {
+		return ""
+	}
+
+	return firstNonEmpty(os.Getenv("TF_WORKSPACE"), readTrimmed(filepath.Join(dataDir, "environment")), "default")
+}
+
+/**
+ * The active gcloud configuration's project (or account, if it has no project).
+ */
+func gcloudProject() string {
+	configDir := firstNonEmpty(os.Getenv("CLOUDSDK_CONFIG"), filepath.Join(HOME, ".config/gcloud"))
+
+	name := firstNonEmpty(os.Getenv("CLOUDSDK_ACTIVE_CONFIG_NAME"), readTrimmed(filepath.Join(configDir, "active_config")))
+	if len(name) == 0 {
+		return ""
+	}
+
+	core := readINIFile(filepath.Join(configDir, "configurations", "config_"+name))["core"]
+
+	return firstNonEmpty(os.Getenv("CLOUDSDK_CORE_PROJECT"), core["project"], core["account"])
+}
+
+/**
+ * The default Azure subscription's name.
+ */
+func azureSubscription() string {
+	configDir := firstNonEmpty(os.Getenv("AZURE_CONFIG_DIR"), filepath.Join(HOME, ".azure"))
+
+	content, err := ioutil.ReadFile(filepath.Join(configDir, "azureProfile.json"))
+	if err != nil {
+		return ""
+	}
+
+	// The CLI writes it with a byte order mark, which encoding/json won't have
+	content = bytes.TrimPrefix(content, []byte("\xef\xbb\xbf"))
+
+	var profile struct {
+		Subscriptions []struct {
+			Name      string `json:"name"`
+			IsDefault bool   `json:"isDefault"`
+		} `json:"subscriptions"`
+	}
+
+	if json.Unmarshal(content, &profile) != nil {
+		return ""
+	}
+
+	for _, subscription := range profile.Subscriptions {
+		if subscription.IsDefault {
+			return subscription.Name
+		}
+	}
+
+	return ""
+}
+
+/**
+ * Terraform workspace, plus GCP and Azure when ~/.host/config/show_gcloud and show_azure exist,
+ * e.g. "tf:staging gcp:my-project az:Dev".  Anything matching production_patterns stands out.
+ */
+func cloudEnvironment() (string, string) {
+	parts := [][2]string{{"tf:", terraformWorkspace()}}
+
+	if fileExists(hostConfigPath("show_gcloud")) {
+		parts = append(parts, [2]string{"gcp:", gcloudProject()})
+	}
+
+	if fileExists(hostConfigPath("show_azure")) {
+		parts = append(parts, [2]string{"az:", azureSubscription()})
+	}
+
+	plain := make([]string, 0)
+	colored := make([]string, 0)
+
+	for _, part := range parts {
+		if len(part[1]) == 0 {
+			continue
+		}
+
+		str := part[0] + part[1]
+		c := themeColor("cloud", color.FgMagenta)
+
+		if isProduction(part[1]) {
+			c = themeColor("cloud-production", color.BgRed, color.FgHiWhite, color.Bold)
+		}
+
+		plain = append(plain, str)
+		colored = append(colored, c.Sprint(str))
+	}
+
+	return strings.Join(plain, " "), strings.Join(colored, " ")
+}
@@ -0,0 +1,325 @@
+package main
+
+/**
+ * Terminal color support and themes
+ */
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/fatih/color"
+)
+
+type ColorDepth int
+
+const (
+	COLOR_DEPTH_16 ColorDepth = iota
+	COLOR_DEPTH_256
+	COLOR_DEPTH_TRUECOLOR
+)
+
+var COLOR_DEPTH = COLOR_DEPTH_TRUECOLOR
+
+// Style name -> attributes, loaded from ~/.host/config/theme
+var THEME = map[string][]color.Attribute{}
+
+////////////////////////////////////////////
+// Capability detection
+////////////////////////////////////////////
+
+/**
+ * Parses the --colors option.  Anything unrecognized means auto-detect.
+ */
+func parseColorDepth(depth string) (ColorDepth, bool) {
+	switch strings.ToLower(depth) {
+	case "16":
+		return COLOR_DEPTH_16, true
+	case "256":
+		return COLOR_DEPTH_256, true
+	case "truecolor", "24bit":
+		return COLOR_DEPTH_TRUECOLOR, true
+	default:
+		return COLOR_DEPTH_16, false
+	}
+}
+
+// TERM values that we know are 16 colors, so we don't need to ask tput.  Plus any TERM ending in
+// one of TERM_SUFFIXES_16_COLOR, e.g. xterm-color.
+var TERMS_16_COLOR = []string{"", "dumb", "linux", "vt100", "vt220", "xterm", "screen", "tmux", "rxvt", "ansi", "cygwin"}
+
+var TERM_SUFFIXES_16_COLOR = []string{"-color", "-16color"}
+
+/**
+ * Figures out how many colors the terminal supports, from most to least reliable:
+ *   COLORTERM (set by terminals that do 24-bit color)
+ *   TERM (xterm-256color, xterm-direct, etc.)
+ *   terminfo's "colors" capability, only for terminals we don't recognize since it forks tput
+ */
+func detectColorDepth() ColorDepth {
+	colorTerm := strings.ToLower(os.Getenv("COLORTERM"))
+	if colorTerm == "truecolor" || colorTerm == "24bit" {
+		return COLOR_DEPTH_TRUECOLOR
+	}
+
+	term := strings.ToLower(os.Getenv("TERM"))
+	if strings.HasSuffix(term, "-direct") {
+		return COLOR_DEPTH_TRUECOLOR
+	} else if strings.Contains(term, "256color") {
+		return COLOR_DEPTH_256
+	}
+
+	for _, known := range TERMS_16_COLOR {
+		if term == known {
+			return COLOR_DEPTH_16
+		}
+	}
+
+	for _, suffix := range TERM_SUFFIXES_16_COLOR {
+		if strings.HasSuffix(term, suffix) {
+			return COLOR_DEPTH_16
+		}
+	}
+
+	output, exitCode, err := execAndGetOutput("tput", nil, "colors")
+	if err == nil && exitCode == 0 {
+		colors, convErr := strconv.Atoi(strings.TrimSpace(output))
+
+		if convErr == nil {
+			if colors >= 1<<24 {
+				return COLOR_DEPTH_TRUECOLOR
+			} else if colors >= 256 {
+				return COLOR_DEPTH_256
+			}
+		}
+	}
+
+	return COLOR_DEPTH_16
+}
+
+////////////////////////////////////////////
+// Downsampling
+////////////////////////////////////////////
+
+/**
+ * Converts an 8-bit color index into the equivalent 16-color SGR code.
+ *
+ * base:    30 for foreground, 40 for background
+ */
+func color8BitToSGR(index int, base int) int {
+	color4Bit := color8BitTo4Bit(index)
+
+	if color4Bit < 8 {
+		return base + color4Bit
+	} else {
+		// Bright colors live 60 codes above the normal ones
+		return base + 60 + (color4Bit - 8)
+	}
+}
+
+/**
+ * Rewrites the codes of one SGR sequence so they fit in the given color depth.
+ */
+func downsampleSGRCodes(codes []int, depth ColorDepth) []int {
+	retval := make([]int, 0, len(codes))
+
+	i := 0
+
+	for i < len(codes) {
+		code := codes[i]
+
+		if (code == 38 || code == 48) && i+1 < len(codes) {
+			base := 30
+			if code == 48 {
+				base = 40
+			}
+
+			index := -1
+			consumed := 0
+
+			if codes[i+1] == 2 && i+4 < len(codes) {
+				// 24-bit color
+				if depth == COLOR_DEPTH_TRUECOLOR {
+					retval = append(retval, codes[i:i+5]...)
+					i += 5
+					continue
+				}
+
+				index = rgbTo8BitIndex(codes[i+2], codes[i+3], codes[i+4])
+				consumed = 5
+			} else if codes[i+1] == 5 && i+2 < len(codes) {
+				// 8-bit color
+				index = codes[i+2]
+				consumed = 3
+			}
+
+			if index < 0 {
+				// Malformed, we can't tell where it ends, so leave the rest alone
+				retval = append(retval, codes[i:]...)
+				break
+			}
+
+			if depth == COLOR_DEPTH_16 {
+				retval = append(retval, color8BitToSGR(index, base))
+			} else {
+				retval = append(retval, code, 5, index)
+			}
+
+			i += consumed
+			continue
+		}
+
+		retval = append(retval, code)
+		i++
+	}
+
+	return retval
+}
+
+/**
+ * Rewrites any colors in the string that the terminal can't display.
+ * Applies to everything we print, including colors passed through from other commands.
+ */
+func downsampleANSI(str string) string {
+	if COLOR_DEPTH == COLOR_DEPTH_TRUECOLOR {
+		return str
+	}
+
+	return ANSI_ESCAPE_REGEXP.ReplaceAllStringFunc(str, func(escape string) string {
+		matches := ANSI_ESCAPE_REGEXP.FindStringSubmatch(escape)
+
+		if matches[2] != "m" || len(matches[1]) == 0 {
+			return escape
+		}
+
+		codes := downsampleSGRCodes(parseSGRCodes(matches[1]), COLOR_DEPTH)
+
+		params := make([]string, len(codes))
+		for i, code := range codes {
+			params[i] = strconv.Itoa(code)
+		}
+
+		return "\x1B[" + strings.Join(params, ";") + "m"
+	})
+}
+
+/**
+ * Prints to the terminal, downsampling colors as needed and escaping them for the shell.
+ */
+func printColored(a ...interface{}) {
+	fmt.Print(wrapForShell(downsampleANSI(fmt.Sprint(a...))))
+}
+
+////////////////////////////////////////////
+// Themes
+////////////////////////////////////////////
+
+var STYLE_ATTRIBUTES = map[string]color.Attribute{
+	"bold":      color.Bold,
+	"faint":     color.Faint,
+	"italic":    color.Italic,
+	"underline": color.Underline,
+	"blink":     color.BlinkSlow,
+	"reverse":   color.ReverseVideo,
+}
+
+/**
+ * Parses a style spec into color attributes.  Specs are comma separated lists of:
+ *   bold, faint, italic, underline, blink, reverse
+ *   color names (red, hired, ...)
+ *   8-bit palette indexes (0-255)
+ *   hex colors (#ff8700)
+ * Any color can be prefixed with "bg-" to make it a background color.
+ */
+func parseStyle(spec string) []color.Attribute {
+	attrs := make([]color.Attribute, 0)
+
+	for _, token := range strings.Split(spec, ",") {
+		token = strings.ToLower(strings.TrimSpace(token))
+
+		if len(token) <= 0 || token == "default" || token == "none" {
+			continue
+		}
+
+		if attr, ok := STYLE_ATTRIBUTES[token]; ok {
+			attrs = append(attrs, attr)
+			continue
+		}
+
+		// Foreground or background?
+		base := 30
+		extended := 38
+		if strings.HasPrefix(token, "bg-") {
+			base = 40
+			extended = 48
+			token = strings.TrimPrefix(token, "bg-")
+		}
+
+		if strings.HasPrefix(token, "#") && len(token) == 7 {
+			// Hex color
+			rgb, err := strconv.ParseUint(token[1:], 16, 32)
+			if err == nil {
+				attrs = append(attrs, color.Attribute(extended), 2,
+					color.Attribute((rgb>>16)&0xFF), color.Attribute((rgb>>8)&0xFF), color.Attribute(rgb&0xFF))
+				continue
+			}
+		} else if index, err := strconv.Atoi(token); err == nil && index >= 0 && index <= 255 {
+			// Palette color
+			attrs = append(attrs, color.Attribute(extended), 5, color.Attribute(index))
+			continue
+		} else {
+			// Named color, with an optional "hi" for bright
+			offset := 0
+			if strings.HasPrefix(token, "hi") {
+				offset = 60
+				token = strings.TrimPrefix(token, "hi")
+			}
+
+			found := false
+			for i, name := range ANSI_COLOR_NAMES {
+				if name == token {
+					attrs = append(attrs, color.Attribute(base+offset+i))
+					found = true
+					break
+				}
+			}
+
+			if found {
+				continue
+			}
+		}
+
+		// Don't log here, it'd end up in every prompt
+	}
+
+	return attrs
+}
+
+/**
+ * Loads style overrides from ~/.host/config/theme, one "name = spec" per line.
+ */
+func loadTheme() {
+	for _, pair := range readHostConfigPairs("theme") {
+		THEME[pair[0]] = parseStyle(pair[1])
+	}
+}
+
+/**
+ * Gets the attributes for a themed style, falling back to the defaults if the theme doesn't set it.
+ */
+func themeAttributes(name string, defaults ...color.Attribute) []color.Attribute {
+	if attrs, ok := THEME[name]; ok {
+		return attrs
+	}
+
+	return defaults
+}
+
+/**
+ * Gets the color for a themed style, falling back to the defaults if the theme doesn't set it.
+ */
+func themeColor(name string, defaults ...color.Attribute) *color.Color {
+	return color.New(themeAttributes(name, defaults...)...)
+}
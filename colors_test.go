@@ -0,0 +1,65 @@
+package main
+
+import (
+	"os"
+	"reflect"
+	"testing"
+)
+
+func TestDownsampleSGRCodes(t *testing.T) {
+	tests := []struct {
+		name     string
+		codes    []int
+		depth    ColorDepth
+		expected []int
+	}{
+		{"basic colors", []int{1, 31, 42}, COLOR_DEPTH_16, []int{1, 31, 42}},
+		{"palette to 16", []int{38, 5, 21}, COLOR_DEPTH_16, []int{94}},
+		{"palette kept", []int{38, 5, 21}, COLOR_DEPTH_256, []int{38, 5, 21}},
+		{"gray background to 16", []int{48, 5, 238}, COLOR_DEPTH_16, []int{100}},
+		{"rgb to 256", []int{38, 2, 255, 0, 0}, COLOR_DEPTH_256, []int{38, 5, 196}},
+		{"rgb kept", []int{38, 2, 255, 0, 0}, COLOR_DEPTH_TRUECOLOR, []int{38, 2, 255, 0, 0}},
+		{"surrounding codes", []int{1, 38, 5, 21, 4}, COLOR_DEPTH_16, []int{1, 94, 4}},
+		// Malformed sequences are left alone rather than reinterpreted
+		{"truncated rgb", []int{38, 2, 255}, COLOR_DEPTH_16, []int{38, 2, 255}},
+		{"truncated palette", []int{1, 48, 5}, COLOR_DEPTH_16, []int{1, 48, 5}},
+		{"unknown color type", []int{38, 7, 1}, COLOR_DEPTH_256, []int{38, 7, 1}},
+	}
+
+	for _, test := range tests {
+		if actual := downsampleSGRCodes(test.codes, test.depth); !reflect.DeepEqual(actual, test.expected) {
+			t.Errorf("%v: got %v, expected %v", test.name, actual, test.expected)
+		}
+	}
+}
+
+func TestDetectColorDepth(t *testing.T) {
+	defer os.Setenv("COLORTERM", os.Getenv("COLORTERM"))
+	defer os.Setenv("TERM", os.Getenv("TERM"))
+
+	tests := []struct {
+		colorTerm string
+		term      string
+		expected  ColorDepth
+	}{
+		{"truecolor", "xterm", COLOR_DEPTH_TRUECOLOR},
+		{"24bit", "", COLOR_DEPTH_TRUECOLOR},
+		{"", "xterm-direct", COLOR_DEPTH_TRUECOLOR},
+		{"", "xterm-256color", COLOR_DEPTH_256},
+		{"", "tmux-256color", COLOR_DEPTH_256},
+		{"", "xterm", COLOR_DEPTH_16},
+		{"", "xterm-color", COLOR_DEPTH_16},
+		{"", "screen-16color", COLOR_DEPTH_16},
+		{"", "dumb", COLOR_DEPTH_16},
+		{"", "", COLOR_DEPTH_16},
+	}
+
+	for _, test := range tests {
+		os.Setenv("COLORTERM", test.colorTerm)
+		os.Setenv("TERM", test.term)
+
+		if actual := detectColorDepth(); actual != test.expected {
+			t.Errorf("COLORTERM=%q TERM=%q: got %v, expected %v", test.colorTerm, test.term, actual, test.expected)
+		}
+	}
+}
@@ -5,15 +5,92 @@ package main
  */
 
 import (
+	"log"
+	"math"
+	"path/filepath"
+	"strconv"
+	"strings"
+
 	linuxproc "github.com/c9s/goprocinfo/linux"
 )
 
 type CPUInfo struct {
-	NumProcessors      int
-	Load1Min           float64
-	Load5Min           float64
-	Load1MinPercentage float64
-	Load5MinPercentage float64
+	NumProcessors int
+
+	// Processors we're allowed to use, less than NumProcessors when a cgroup quota limits us
+	EffectiveProcessors float64
+
+	Load1Min            float64
+	Load5Min            float64
+	Load15Min           float64
+	Load1MinPercentage  float64
+	Load5MinPercentage  float64
+	Load15MinPercentage float64
+}
+
+/**
+ * Where our cgroup's files are, for each of the (v1) controllers plus "" for the v2 hierarchy.
+ */
+func cgroupPaths() map[string]string {
+	paths := map[string]string{}
+
+	for _, line := range strings.Split(readTrimmed("/proc/self/cgroup"), "\n") {
+		// hierarchy-id:controllers:path
+		parts := strings.SplitN(line, ":", 3)
+		if len(parts) != 3 {
+			continue
+		}
+
+		for _, controller := range strings.Split(parts[1], ",") {
+			paths[controller] = parts[2]
+		}
+	}
+
+	return paths
+}
+
+/**
+ * How many CPUs our cgroup's quota works out to, or 0 if there's no limit.
+ * Containers usually see their own cgroup as the root, so that's checked too.
+ */
+func cgroupCPULimit() float64 {
+	paths := cgroupPaths()
+
+	// cgroup v2: "quota period" in cpu.max, or "max period" for no limit
+	if path, ok := paths[""]; ok {
+		for _, dir := range []string{filepath.Join("/sys/fs/cgroup", path), "/sys/fs/cgroup"} {
+			fields := strings.Fields(readTrimmed(filepath.Join(dir, "cpu.max")))
+
+			if len(fields) == 2 {
+				quota, quotaErr := strconv.ParseFloat(fields[0], 64)
+				period, periodErr := strconv.ParseFloat(fields[1], 64)
+
+				if quotaErr == nil && periodErr == nil && period > 0 {
+					return quota / period
+				}
+
+				break
+			}
+		}
+	}
+
+	// cgroup v1: quota of -1 for no limit
+	if path, ok := paths["cpu"]; ok {
+		for _, dir := range []string{filepath.Join("/sys/fs/cgroup/cpu", path), "/sys/fs/cgroup/cpu"} {
+			quota, quotaErr := strconv.ParseFloat(readTrimmed(filepath.Join(dir, "cpu.cfs_quota_us")), 64)
+			period, periodErr := strconv.ParseFloat(readTrimmed(filepath.Join(dir, "cpu.cfs_period_us")), 64)
+
+			if quotaErr == nil && periodErr == nil {
+				if quota > 0 && period > 0 {
+					return quota / period
+				}
+
+				break
+			}
+		}
+	}
+
+	return 0
 }
 
 func NewCPUInfo() *CPUInfo {
@@ -27,19 +104,117 @@ func NewCPUInfo() *CPUInfo {
 		info.NumProcessors = len(stats.CPUStats)
 	}
 
+	info.EffectiveProcessors = float64(info.NumProcessors)
+
+	if limit := cgroupCPULimit(); limit > 0 && limit < info.EffectiveProcessors {
+		// Load is counted against the whole machine, but we'll only ever get this much of it
+		info.EffectiveProcessors = math.Max(limit, 1)
+	}
+
 	// Read load average
 	loadavg, loadErr := linuxproc.ReadLoadAvg("/proc/loadavg")
 
 	if loadErr == nil {
 		info.Load1Min = loadavg.Last1Min
 		info.Load5Min = loadavg.Last5Min
+		info.Load15Min = loadavg.Last15Min
 	}
 
 	// Calculate percentages
-	if info.NumProcessors > 0 {
-		info.Load1MinPercentage = info.Load1Min / float64(info.NumProcessors)
-		info.Load5MinPercentage = info.Load5Min / float64(info.NumProcessors)
+	if info.EffectiveProcessors > 0 {
+		info.Load1MinPercentage = info.Load1Min / info.EffectiveProcessors
+		info.Load5MinPercentage = info.Load5Min / info.EffectiveProcessors
+		info.Load15MinPercentage = info.Load15Min / info.EffectiveProcessors
 	}
 
 	return info
 }
+
+////////////////////////////////////////////
+// Load display
+////////////////////////////////////////////
+
+type LoadSettings struct {
+	// Which average to use: 1, 5 or 15 minutes
+	Average int
+
+	// Load per processor where each level starts
+	Low      float64
+	Medium   float64
+	High     float64
+	Critical float64
+
+	// Show the number from this load on
+	Show float64
+}
+
+var DEFAULT_LOAD_SETTINGS = LoadSettings{
+	Average:  1,
+	Low:      0.25,
+	Medium:   0.50,
+	High:     0.75,
+	Critical: 1.00,
+	Show:     0.50,
+}
+
+/**
+ * Load settings from ~/.host/config/load, "key = value" per line with the keys from LoadSettings
+ * in lower case.
+ */
+func loadSettings() LoadSettings {
+	settings := DEFAULT_LOAD_SETTINGS
+
+	for _, pair := range readHostConfigPairs("load") {
+		value, err := strconv.ParseFloat(pair[1], 64)
+		if err != nil {
+			log.Printf("Ignoring bad load setting (%v): %v", pair[0], err)
+			continue
+		}
+
+		switch pair[0] {
+		case "average":
+			settings.Average = int(value)
+		case "low":
+			settings.Low = value
+		case "medium":
+			settings.Medium = value
+		case "high":
+			settings.High = value
+		case "critical":
+			settings.Critical = value
+		case "show":
+			settings.Show = value
+		default:
+			log.Printf("Ignoring unknown load setting: %v", pair[0])
+		}
+	}
+
+	return settings
+}
+
+/**
+ * The load and load per processor for the chosen average.
+ */
+func (c *CPUInfo) Load(average int) (float64, float64) {
+	switch average {
+	case 5:
+		return c.Load5Min, c.Load5MinPercentage
+	case 15:
+		return c.Load15Min, c.Load15MinPercentage
+	default:
+		return c.Load1Min, c.Load1MinPercentage
+	}
+}
+
+/**
+ * Whether load is going up or down, from the 1 minute average against the 5 minute one.
+ */
+func (c *CPUInfo) Trend() string {
+	if c.Load1Min > c.Load5Min*1.1 {
+		return "↑"
+	} else if c.Load1Min < c.Load5Min*0.9 {
+		return "↓"
+	}
+
+	return ""
+}
@@ -0,0 +1,326 @@
+package main
+
+/**
+ * Credential checks for the login cert segment
+ *
+ * Each check reports whether a credential (Kerberos ticket, SSH agent keys, certificate, ...) is still
+ * good and, when it knows, when it expires.  Anything that isn't valid shows up as a flag:
+ *   K       expired (or missing)
+ *   K:12m   expiring soon
+ *   K?      couldn't tell
+ */
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/fatih/color"
+)
+
+// Credentials expiring within this long get a countdown
+var CREDENTIAL_WARNING = 30 * time.Minute
+
+type CredentialState int
+
+const (
+	CREDENTIAL_VALID CredentialState = iota
+	CREDENTIAL_EXPIRING
+	CREDENTIAL_EXPIRED
+	CREDENTIAL_UNKNOWN
+)
+
+type CredentialStatus struct {
+	Label string
+	State CredentialState
+
+	// Zero if the check doesn't know
+	Expires time.Time
+}
+
+type CredentialCheck interface {
+	Check() CredentialStatus
+}
+
+/**
+ * Works out the state from an expiry time.
+ */
+func credentialStatusFromExpiry(label string, expires time.Time) CredentialStatus {
+	return credentialStatusFromExpiryWithin(label, expires, CREDENTIAL_WARNING)
+}
+
+/**
+ * Works out the state from an expiry time, with a custom warning period.
+ */
+func credentialStatusFromExpiryWithin(label string, expires time.Time, warning time.Duration) CredentialStatus {
+	status := CredentialStatus{Label: label, State: CREDENTIAL_VALID, Expires: expires}
+
+	remaining := expires.Sub(NOW())
+
+	if remaining <= 0 {
+		status.State = CREDENTIAL_EXPIRED
+	} else if remaining <= warning {
+		status.State = CREDENTIAL_EXPIRING
+	}
+
+	return status
+}
+
+/**
+ * Short countdown: "12m" under an hour, "3h05" after that.
+ */
+func formatCountdown(remaining time.Duration) string {
+	if remaining < 0 {
+		remaining = 0
+	}
+
+	if remaining < time.Hour {
+		return fmt.Sprintf("%dm", int(remaining.Minutes()))
+	} else {
+		return fmt.Sprintf("%dh%02d", int(remaining.Hours()), int(remaining.Minutes())%60)
+	}
+}
+
+/**
+ * The flag to show for a status, empty when it's valid.
+ */
+func (s CredentialStatus) Flag() (string, string) {
+	str := ""
+	c := themeColor("login-cert", color.FgHiRed, color.Bold)
+
+	switch s.State {
+	case CREDENTIAL_VALID:
+		return "", ""
+	case CREDENTIAL_EXPIRING:
+		str = s.Label + ":" + formatCountdown(s.Expires.Sub(NOW()))
+		c = themeColor("login-cert-expiring", color.FgHiYellow, color.Bold)
+	case CREDENTIAL_EXPIRED:
+		str = s.Label
+	case CREDENTIAL_UNKNOWN:
+		str = s.Label + "?"
+		c = themeColor("login-cert-unknown", color.FgMagenta)
+	}
+
+	return str, c.Sprint(str)
+}
+
+////////////////////////////////////////////
+// Built-in checks
+////////////////////////////////////////////
+
+/**
+ * Kerberos ticket, when ~/.host/config/check_kerberos exists.  Reads the expiry straight from the
+ * credential cache, falling back on klist for cache types we can't read.
+ */
+type KerberosCheck struct{}
+
+func (k KerberosCheck) Check() CredentialStatus {
+	tgt, readable, err := currentKerberosTGT()
+
+	if readable {
+		if err == nil {
+			return credentialStatusFromExpiry("K", tgt.EndTime)
+		} else if err == ErrNoKerberosTGT {
+			return CredentialStatus{Label: "K", State: CREDENTIAL_EXPIRED}
+		}
+
+		// Couldn't read or parse the cache, let klist decide
+	}
+
+	// Do we have a ticket?
+	_, exitCode, _ := execAndGetOutput("klist", nil, "-s")
+
+	if exitCode == 0 {
+		return CredentialStatus{Label: "K", State: CREDENTIAL_VALID}
+	} else {
+		return CredentialStatus{Label: "K", State: CREDENTIAL_EXPIRED}
+	}
+}
+
+/**
+ * Midway cert, when ~/.host/config/check_midway exists.  Uses the session cookie's expiry when
+ * there's a cookie jar, otherwise asks mwinit.
+ */
+type MidwayCheck struct{}
+
+func (m MidwayCheck) Check() CredentialStatus {
+	cookie := expandHome("~/.midway/cookie")
+
+	if fileExists(cookie) {
+		status := CertFileCheck{Label: "M", Path: cookie, Cookie: "session"}.Check()
+
+		if status.State != CREDENTIAL_UNKNOWN {
+			return status
+		}
+	}
+
+	output, exitCode, _ := execAndGetOutput("mwinit", nil, "-l")
+
+	if exitCode == 0 && len(output) > 0 {
+		return CredentialStatus{Label: "M", State: CREDENTIAL_VALID}
+	} else {
+		return CredentialStatus{Label: "M", State: CREDENTIAL_EXPIRED}
+	}
+}
+
+/**
+ * Keys loaded in the SSH agent, when ~/.host/config/check_ssh_agent exists.
+ * The agent doesn't say when keys expire, so this is only ever valid, expired (no keys) or unknown.
+ */
+type SSHAgentCheck struct{}
+
+func (a SSHAgentCheck) Check() CredentialStatus {
+	if len(os.Getenv("SSH_AUTH_SOCK")) == 0 {
+		return CredentialStatus{Label: "S", State: CREDENTIAL_UNKNOWN}
+	}
+
+	_, exitCode, _ := execAndGetOutput("ssh-add", nil, "-l")
+
+	switch exitCode {
+	case 0:
+		return CredentialStatus{Label: "S", State: CREDENTIAL_VALID}
+	case 1:
+		// Agent is running, but has no keys
+		return CredentialStatus{Label: "S", State: CREDENTIAL_EXPIRED}
+	default:
+		// Couldn't talk to the agent
+		return CredentialStatus{Label: "S", State: CREDENTIAL_UNKNOWN}
+	}
+}
+
+/**
+ * AWS credentials for the current profile, when we can tell when they expire.
+ */
+type AWSCheck struct{}
+
+func (a AWSCheck) Check() CredentialStatus {
+	info := currentAWSInfo()
+
+	if info == nil || info.Expiration.IsZero() {
+		return CredentialStatus{Label: "A", State: CREDENTIAL_VALID}
+	}
+
+	return credentialStatusFromExpiry("A", info.Expiration)
+}
+
+////////////////////////////////////////////
+// Scripted checks
+////////////////////////////////////////////
+
+/**
+ * Runs an executable from ~/.host/config/login_certs.  Scripts print "key=value" lines:
+ *
+ *   label=V                           Flag to show (defaults to the script's name)
+ *   state=valid|expired|unknown       Defaults to valid if there's an expiry, otherwise unknown
+ *   expires=2024-01-02T15:04:05Z      RFC 3339, or seconds since the epoch
+ *
+ * Older scripts that just print a flag (or nothing, when everything's fine) still work: any output
+ * that isn't in the format above is shown as an expired flag.
+ */
+type ScriptCheck struct {
+	Path string
+}
+
+func (s ScriptCheck) Check() CredentialStatus {
+	output, _, _ := execAndGetOutput(s.Path, nil)
+	output = strings.TrimSpace(output)
+
+	if len(output) <= 0 {
+		return CredentialStatus{Label: filepath.Base(s.Path), State: CREDENTIAL_VALID}
+	}
+
+	values := map[string]string{}
+
+	for _, line := range strings.Split(output, "\n") {
+		parts := strings.SplitN(strings.TrimSpace(line), "=", 2)
+
+		if len(parts) != 2 {
+			// Not the protocol, treat the whole thing as a flag
+			return CredentialStatus{Label: output, State: CREDENTIAL_EXPIRED}
+		}
+
+		values[strings.TrimSpace(parts[0])] = strings.TrimSpace(parts[1])
+	}
+
+	label, ok := values["label"]
+	if !ok {
+		label = filepath.Base(s.Path)
+	}
+
+	status := CredentialStatus{Label: label, State: CREDENTIAL_UNKNOWN}
+
+	if expires, ok := values["expires"]; ok {
+		if t, err := time.Parse(time.RFC3339, expires); err == nil {
+			status = credentialStatusFromExpiry(label, t)
+		} else if seconds, err := strconv.ParseInt(expires, 10, 64); err == nil {
+			status = credentialStatusFromExpiry(label, time.Unix(seconds, 0))
+		}
+	}
+
+	switch values["state"] {
+	case "valid":
+		if status.State == CREDENTIAL_UNKNOWN {
+			status.State = CREDENTIAL_VALID
+		}
+	case "expired":
+		status.State = CREDENTIAL_EXPIRED
+	case "unknown":
+		status.State = CREDENTIAL_UNKNOWN
+	}
+
+	return status
+}
+
+////////////////////////////////////////////
+// Configuration
+////////////////////////////////////////////
+
+/**
+ * All of the checks enabled for this host.
+ */
+func credentialChecks() []CredentialCheck {
+	checks := make([]CredentialCheck, 0)
+
+	if fileExists(hostConfigPath("check_kerberos")) {
+		checks = append(checks, KerberosCheck{})
+	}
+
+	if fileExists(hostConfigPath("check_midway")) {
+		checks = append(checks, MidwayCheck{})
+	}
+
+	if fileExists(hostConfigPath("check_ssh_agent")) {
+		checks = append(checks, SSHAgentCheck{})
+	}
+
+	checks = append(checks, certFileChecks()...)
+
+	checks = append(checks, AWSCheck{})
+
+	path := hostConfigPath("login_certs")
+	if fileExists(path) {
+		fileInfo, err := ioutil.ReadDir(path)
+		if err == nil {
+			for _, file := range fileInfo {
+				if file.Mode().IsDir() {
+					continue
+				}
+
+				perm := file.Mode().Perm() & (^os.ModeType)
+				isExec := (perm & 0111) != 0
+
+				if !isExec {
+					continue
+				}
+
+				checks = append(checks, ScriptCheck{Path: filepath.Join(path, file.Name())})
+			}
+		}
+	}
+
+	return checks
+}
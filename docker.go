@@ -0,0 +1,135 @@
+package main
+
+/**
+ * Docker context and compose project, read from the config files without running docker
+ */
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/fatih/color"
+	"gopkg.in/yaml.v2"
+)
+
+var COMPOSE_FILES = []string{"compose.yaml", "compose.yml", "docker-compose.yml", "docker-compose.yaml"}
+
+func dockerConfigDir() string {
+	return firstNonEmpty(os.Getenv("DOCKER_CONFIG"), filepath.Join(HOME, ".docker"))
+}
+
+/**
+ * The docker context in use, the same way the CLI picks it: DOCKER_HOST, then DOCKER_CONTEXT, then
+ * currentContext in config.json.  DOCKER_HOST wins because the CLI uses the default context with
+ * that host and ignores DOCKER_CONTEXT.  Empty for the default local daemon.
+ */
+func dockerContext() string {
+	if host := os.Getenv("DOCKER_HOST"); len(host) > 0 {
+		u, err := url.Parse(host)
+		if err != nil {
+			return host
+		}
+
+		// Sockets are a local daemon, e.g. rootless docker
+		if u.Scheme == "unix" || u.Scheme == "npipe" {
+			return ""
+		}
+
+		// Just the host, "tcp://build-box:2376" is long for what it says
+		if len(u.Hostname()) > 0 {
+			return u.Hostname()
+		}
+
+		return host
+	}
+
+	if context := os.Getenv("DOCKER_CONTEXT"); len(context) > 0 {
+		if context == "default" {
+			return ""
+		}
+
+		return context
+	}
+
+	content, err := ioutil.ReadFile(filepath.Join(dockerConfigDir(), "config.json"))
+	if err != nil {
+		return ""
+	}
+
+	var config struct {
+		CurrentContext string `json:"currentContext"`
+	}
+
+	if json.Unmarshal(content, &config) != nil || config.CurrentContext == "default" {
+		return ""
+	}
+
+	return config.CurrentContext
+}
+
+var COMPOSE_NAME_INVALID_REGEXP = regexp.MustCompile(`[^a-z0-9_-]`)
+
+/**
+ * The compose project for the directory, or empty if there's no compose file.  Named by
+ * COMPOSE_PROJECT_NAME, the file's top level "name", or the directory the file is in.
+ */
+func composeProject() string {
+	path := findUpwards(WORKING_DIRECTORY, COMPOSE_FILES...)
+
+	if len(path) == 0 {
+		return ""
+	}
+
+	if name := os.Getenv("COMPOSE_PROJECT_NAME"); len(name) > 0 {
+		return name
+	}
+
+	content, err := ioutil.ReadFile(path)
+	if err == nil {
+		var compose struct {
+			Name string `yaml:"name"`
+		}
+
+		if yaml.Unmarshal(content, &compose) == nil && len(compose.Name) > 0 {
+			return compose.Name
+		}
+	}
+
+	// Compose lower cases the directory name and drops anything it doesn't allow
+	name := strings.ToLower(filepath.Base(filepath.Dir(path)))
+
+	return COMPOSE_NAME_INVALID_REGEXP.ReplaceAllString(name, "")
+}
+
+func dockerInfo() (string, string) {
+	context := dockerContext()
+
+	if len(context) == 0 {
+		return "", ""
+	}
+
+	str := "docker:" + context
+
+	if isProduction(context) {
+		return str, themeColor("docker-production", color.BgRed, color.FgHiWhite, color.Bold).Sprint(str)
+	} else {
+		return str, themeColor("docker", color.FgBlue).Sprint(str)
+	}
+}
+
+func composeInfo() (string, string) {
+	project := composeProject()
+
+	if len(project) == 0 {
+		return "", ""
+	}
+
+	str := "compose:" + project
+
+	return str, themeColor("compose", color.FgHiBlue).Sprint(str)
+}
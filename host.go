@@ -0,0 +1,138 @@
+package main
+
+/**
+ * Host name and color: what the machine is called, cleaned up and made recognizable
+ */
+
+import (
+	"hash/fnv"
+	"log"
+	"os"
+	"regexp"
+	"strings"
+
+	"github.com/fatih/color"
+)
+
+// 256 color palette entries that read well on dark and light backgrounds, for hash_host_color
+var HOST_HASH_COLORS = []int{
+	33, 37, 39, 43, 63, 69, 72, 75, 79, 99, 105, 108, 111, 114, 135, 141,
+	150, 168, 170, 172, 173, 175, 178, 179, 180, 184, 203, 204, 207, 209, 214, 215,
+}
+
+/**
+ * The machine's pretty name from /etc/machine-info (what hostnamectl --pretty sets), or the
+ * regular hostname.
+ */
+func prettyHostname() string {
+	for _, line := range strings.Split(readTrimmed("/etc/machine-info"), "\n") {
+		if strings.HasPrefix(line, "PRETTY_HOSTNAME=") {
+			// Shell syntax, so it may be quoted
+			pretty := strings.Trim(strings.TrimPrefix(line, "PRETTY_HOSTNAME="), "\"'")
+
+			if len(pretty) > 0 {
+				return pretty
+			}
+		}
+	}
+
+	hostName, err := os.Hostname()
+	if err != nil {
+		return "!host!"
+	}
+
+	return hostName
+}
+
+/**
+ * Drops the domains listed in ~/.host/config/host_domains, one per line.  A "*" drops everything
+ * after the first dot.
+ */
+func stripHostDomain(hostName string) string {
+	for _, domain := range readHostConfigLines("host_domains") {
+		if domain == "*" {
+			return strings.SplitN(hostName, ".", 2)[0]
+		}
+
+		domain = "." + strings.TrimPrefix(domain, ".")
+		if strings.HasSuffix(hostName, domain) {
+			return strings.TrimSuffix(hostName, domain)
+		}
+	}
+
+	return hostName
+}
+
+/**
+ * Applies the first matching rule from ~/.host/config/host_rules, one "regex = name[, style]" per
+ * line.  The name can use the regex's groups ($1), and the style is a theme spec.
+ */
+func applyHostRules(hostName string) (string, []color.Attribute, bool) {
+	for _, pair := range readHostConfigPairs("host_rules") {
+		re, err := regexp.Compile(pair[0])
+		if err != nil {
+			log.Printf("Ignoring bad host rule (%v): %v", pair[0], err)
+			continue
+		}
+
+		match := re.FindStringSubmatchIndex(hostName)
+		if match == nil {
+			continue
+		}
+
+		parts := strings.SplitN(pair[1], ",", 2)
+
+		name := string(re.ExpandString(nil, strings.TrimSpace(parts[0]), hostName, match))
+		if len(name) == 0 {
+			name = hostName
+		}
+
+		var style []color.Attribute
+		if len(parts) > 1 {
+			style = parseStyle(parts[1])
+		}
+
+		return name, style, true
+	}
+
+	return hostName, nil, false
+}
+
+/**
+ * A color picked from the hostname, so it's the same every time on the same box.
+ */
+func hostHashColor(hostName string) []color.Attribute {
+	hash := fnv.New32a()
+	hash.Write([]byte(hostName))
+
+	index := HOST_HASH_COLORS[hash.Sum32()%uint32(len(HOST_HASH_COLORS))]
+
+	return []color.Attribute{38, 5, color.Attribute(index)}
+}
+
+/**
+ * The name to show for this host and its color (before any load warnings).
+ */
+func hostIdentity() (string, *color.Color) {
+	fullName := strings.TrimSpace(prettyHostname())
+
+	c := themeColor("host", color.FgCyan)
+
+	if len(currentSession().Remote) > 0 {
+		c = themeColor("host-remote", color.FgGreen)
+	}
+
+	if fileExists(hostConfigPath("hash_host_color")) {
+		c = color.New(hostHashColor(fullName)...)
+	}
+
+	name, style, matched := applyHostRules(fullName)
+
+	if !matched {
+		name = stripHostDomain(fullName)
+	} else if len(style) > 0 {
+		c = color.New(style...)
+	}
+
+	return name, c
+}
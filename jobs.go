@@ -0,0 +1,139 @@
+package main
+
+/**
+ * Background jobs: how many are running or suspended, and what they are when the shell tells us
+ */
+
+import (
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+
+	"github.com/fatih/color"
+)
+
+const (
+	JOB_STYLE_COUNT = "count" // "⚙2 ⏸1" after the host
+	JOB_STYLE_AT    = "at"    // Just the color of the @
+)
+
+var JOB_STYLE = JOB_STYLE_COUNT
+
+var RUNNING_JOBS int
+var SUSPENDED_JOBS int
+var RUNNING_JOB_NAMES []string
+var SUSPENDED_JOB_NAMES []string
+
+// Names beyond this many are shown as "+N"
+var MAX_JOB_NAMES = 2
+
+/**
+ * Parses "--jobs=RUNNING[,SUSPENDED]".
+ */
+func parseJobCounts(counts string) (int, int) {
+	running := 0
+	suspended := 0
+
+	if len(counts) == 0 {
+		return running, suspended
+	}
+
+	parts := strings.Split(counts, ",")
+
+	running, err := strconv.Atoi(strings.TrimSpace(parts[0]))
+	if err != nil {
+		log.Printf("Ignoring bad running job count: %v", parts[0])
+	}
+
+	if len(parts) > 1 {
+		suspended, err = strconv.Atoi(strings.TrimSpace(parts[1]))
+		if err != nil {
+			log.Printf("Ignoring bad suspended job count: %v", parts[1])
+		}
+	}
+
+	return running, suspended
+}
+
+/**
+ * Parses "--jobnames=running:make,suspended:vim", the same states zsh uses in $jobstates.
+ */
+func parseJobNames(names string) ([]string, []string) {
+	running := make([]string, 0)
+	suspended := make([]string, 0)
+
+	for _, entry := range strings.Split(names, ",") {
+		parts := strings.SplitN(strings.TrimSpace(entry), ":", 2)
+		if len(parts) != 2 || len(parts[1]) == 0 {
+			continue
+		}
+
+		switch parts[0] {
+		case "running":
+			running = append(running, parts[1])
+		case "suspended", "stopped":
+			suspended = append(suspended, parts[1])
+		}
+	}
+
+	return running, suspended
+}
+
+/**
+ * "make,vim,+2" for names, or the count when we don't have them.
+ */
+func describeJobs(count int, names []string) string {
+	if len(names) == 0 {
+		if count > 0 {
+			return strconv.Itoa(count)
+		}
+
+		// Only know that there are some
+		return ""
+	}
+
+	shown := names
+	if len(shown) > MAX_JOB_NAMES {
+		shown = shown[:MAX_JOB_NAMES]
+	}
+
+	str := strings.Join(shown, ",")
+
+	if len(names) > len(shown) {
+		str += fmt.Sprintf(",+%d", len(names)-len(shown))
+	}
+
+	return str
+}
+
+/**
+ * Jobs for the count style, with just the counts as the compact form.
+ */
+func jobCounts() (string, string, string, string) {
+	plain := make([]string, 0)
+	colored := make([]string, 0)
+	compactPlain := make([]string, 0)
+	compactColored := make([]string, 0)
+
+	add := func(icon string, count int, names []string, c *color.Color) {
+		full := icon + describeJobs(count, names)
+		compact := icon + describeJobs(count, nil)
+
+		plain = append(plain, full)
+		colored = append(colored, c.Sprint(full))
+		compactPlain = append(compactPlain, compact)
+		compactColored = append(compactColored, c.Sprint(compact))
+	}
+
+	if HAS_RUNNING_JOBS {
+		add("⚙", RUNNING_JOBS, RUNNING_JOB_NAMES, themeColor("jobs-running", color.FgHiGreen, color.Bold))
+	}
+
+	if HAS_SUSPENDED_JOBS {
+		add("⏸", SUSPENDED_JOBS, SUSPENDED_JOB_NAMES, themeColor("jobs-suspended", color.FgHiRed, color.Bold))
+	}
+
+	return strings.Join(plain, " "), strings.Join(colored, " "),
+		strings.Join(compactPlain, " "), strings.Join(compactColored, " ")
+}
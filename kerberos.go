@@ -0,0 +1,364 @@
+package main
+
+/**
+ * Reads Kerberos FILE: credential caches, so we know when tickets expire without running klist.
+ *
+ * Format: https://web.mit.edu/kerberos/krb5-latest/doc/formats/ccache_file_format.html
+ */
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+type KerberosPrincipal struct {
+	Realm      string
+	Components []string
+}
+
+func (p KerberosPrincipal) String() string {
+	return strings.Join(p.Components, "/") + "@" + p.Realm
+}
+
+type KerberosCredential struct {
+	Client KerberosPrincipal
+	Server KerberosPrincipal
+
+	AuthTime  time.Time
+	StartTime time.Time
+	EndTime   time.Time
+	RenewTill time.Time
+}
+
+type KerberosCache struct {
+	Principal   KerberosPrincipal
+	Credentials []KerberosCredential
+}
+
+/**
+ * The ticket granting ticket for the cache's principal, or nil if there isn't one.
+ */
+func (c *KerberosCache) TGT() *KerberosCredential {
+	var fallback *KerberosCredential
+
+	for i := range c.Credentials {
+		cred := &c.Credentials[i]
+		server := cred.Server
+
+		if len(server.Components) != 2 || server.Components[0] != "krbtgt" {
+			continue
+		}
+
+		if server.Components[1] == c.Principal.Realm {
+			return cred
+		} else if fallback == nil {
+			// Cross-realm TGT, better than nothing
+			fallback = cred
+		}
+	}
+
+	return fallback
+}
+
+/**
+ * Where the credential cache is, from KRB5CCNAME or the default.  Returns false for cache types we
+ * can't read (KEYRING:, KCM:, ...), including when there's no default file cache.
+ */
+func kerberosCachePath() (string, bool) {
+	name := os.Getenv("KRB5CCNAME")
+
+	if len(name) == 0 {
+		// Only the default on some systems, others default to KEYRING:, KCM: or API:
+		path := fmt.Sprintf("/tmp/krb5cc_%d", os.Getuid())
+
+		return path, fileExists(path)
+	}
+
+	if strings.HasPrefix(name, "FILE:") {
+		return strings.TrimPrefix(name, "FILE:"), true
+	}
+
+	if strings.HasPrefix(name, "DIR::") {
+		// A specific cache in a collection
+		return strings.TrimPrefix(name, "DIR::"), true
+	}
+
+	if strings.HasPrefix(name, "DIR:") {
+		// The collection's primary cache is named in its "primary" file
+		dir := strings.TrimPrefix(name, "DIR:")
+		primary, err := ioutil.ReadFile(filepath.Join(dir, "primary"))
+		if err != nil {
+			return "", false
+		}
+
+		return filepath.Join(dir, strings.TrimSpace(string(primary))), true
+	}
+
+	if strings.Contains(name, ":") && !strings.HasPrefix(name, "/") {
+		// Some other type
+		return "", false
+	}
+
+	return name, true
+}
+
+type kerberosCacheReader struct {
+	r       *bytes.Reader
+	version uint16
+}
+
+func (k *kerberosCacheReader) uint8() (uint8, error) {
+	var v uint8
+	err := binary.Read(k.r, binary.BigEndian, &v)
+	return v, err
+}
+
+func (k *kerberosCacheReader) uint16() (uint16, error) {
+	var v uint16
+	err := binary.Read(k.r, binary.BigEndian, &v)
+	return v, err
+}
+
+func (k *kerberosCacheReader) uint32() (uint32, error) {
+	var v uint32
+	err := binary.Read(k.r, binary.BigEndian, &v)
+	return v, err
+}
+
+func (k *kerberosCacheReader) skip(n int64) error {
+	if n > int64(k.r.Len()) {
+		return io.ErrUnexpectedEOF
+	}
+
+	_, err := k.r.Seek(n, io.SeekCurrent)
+	return err
+}
+
+func (k *kerberosCacheReader) data() ([]byte, error) {
+	length, err := k.uint32()
+	if err != nil {
+		return nil, err
+	}
+
+	if int64(length) > int64(k.r.Len()) {
+		return nil, io.ErrUnexpectedEOF
+	}
+
+	data := make([]byte, length)
+	_, err = io.ReadFull(k.r, data)
+	return data, err
+}
+
+func (k *kerberosCacheReader) skipData() error {
+	length, err := k.uint32()
+	if err != nil {
+		return err
+	}
+
+	return k.skip(int64(length))
+}
+
+func (k *kerberosCacheReader) time() (time.Time, error) {
+	t, err := k.uint32()
+	if err != nil || t == 0 {
+		return time.Time{}, err
+	}
+
+	return time.Unix(int64(t), 0), nil
+}
+
+func (k *kerberosCacheReader) principal() (KerberosPrincipal, error) {
+	var p KerberosPrincipal
+
+	// Name type, we don't care
+	if _, err := k.uint32(); err != nil {
+		return p, err
+	}
+
+	count, err := k.uint32()
+	if err != nil {
+		return p, err
+	}
+
+	realm, err := k.data()
+	if err != nil {
+		return p, err
+	}
+	p.Realm = string(realm)
+
+	for i := uint32(0); i < count; i++ {
+		component, err := k.data()
+		if err != nil {
+			return p, err
+		}
+		p.Components = append(p.Components, string(component))
+	}
+
+	return p, nil
+}
+
+func (k *kerberosCacheReader) credential() (KerberosCredential, error) {
+	var cred KerberosCredential
+	var err error
+
+	if cred.Client, err = k.principal(); err != nil {
+		return cred, err
+	}
+	if cred.Server, err = k.principal(); err != nil {
+		return cred, err
+	}
+
+	// Keyblock: version 3 repeats the enctype
+	if k.version == 0x0503 {
+		if _, err = k.uint16(); err != nil {
+			return cred, err
+		}
+	}
+	if _, err = k.uint16(); err != nil {
+		return cred, err
+	}
+	if err = k.skipData(); err != nil {
+		return cred, err
+	}
+
+	if cred.AuthTime, err = k.time(); err != nil {
+		return cred, err
+	}
+	if cred.StartTime, err = k.time(); err != nil {
+		return cred, err
+	}
+	if cred.EndTime, err = k.time(); err != nil {
+		return cred, err
+	}
+	if cred.RenewTill, err = k.time(); err != nil {
+		return cred, err
+	}
+
+	if cred.StartTime.IsZero() {
+		cred.StartTime = cred.AuthTime
+	}
+
+	// is_skey, ticket_flags
+	if err = k.skip(1 + 4); err != nil {
+		return cred, err
+	}
+
+	// Addresses and authdata are both lists of (type, data)
+	for list := 0; list < 2; list++ {
+		count, err := k.uint32()
+		if err != nil {
+			return cred, err
+		}
+
+		for i := uint32(0); i < count; i++ {
+			if _, err = k.uint16(); err != nil {
+				return cred, err
+			}
+			if err = k.skipData(); err != nil {
+				return cred, err
+			}
+		}
+	}
+
+	// Ticket and second ticket
+	if err = k.skipData(); err != nil {
+		return cred, err
+	}
+	if err = k.skipData(); err != nil {
+		return cred, err
+	}
+
+	return cred, nil
+}
+
+/**
+ * Parses a FILE: credential cache (versions 3 and 4, which is everything written in the last 20 years).
+ */
+func ParseKerberosCache(content []byte) (*KerberosCache, error) {
+	k := &kerberosCacheReader{r: bytes.NewReader(content)}
+
+	version, err := k.uint16()
+	if err != nil {
+		return nil, err
+	}
+
+	if version != 0x0503 && version != 0x0504 {
+		return nil, fmt.Errorf("unsupported credential cache version: %#04x", version)
+	}
+	k.version = version
+
+	if version == 0x0504 {
+		// Header tags (KDC time offset), we don't need them
+		headerLength, err := k.uint16()
+		if err != nil {
+			return nil, err
+		}
+		if err = k.skip(int64(headerLength)); err != nil {
+			return nil, err
+		}
+	}
+
+	cache := &KerberosCache{}
+
+	if cache.Principal, err = k.principal(); err != nil {
+		return nil, err
+	}
+
+	for k.r.Len() > 0 {
+		cred, err := k.credential()
+		if err != nil {
+			return nil, err
+		}
+
+		// Skip the entries krb5 uses to store cache configuration
+		if cred.Server.Realm == "X-CACHECONF:" {
+			continue
+		}
+
+		cache.Credentials = append(cache.Credentials, cred)
+	}
+
+	return cache, nil
+}
+
+func ReadKerberosCache(path string) (*KerberosCache, error) {
+	content, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	return ParseKerberosCache(content)
+}
+
+var ErrNoKerberosTGT = errors.New("no ticket granting ticket in cache")
+
+/**
+ * Loads the TGT from the current credential cache.
+ * Returns false if the cache isn't a type we can read.
+ */
+func currentKerberosTGT() (*KerberosCredential, bool, error) {
+	path, ok := kerberosCachePath()
+	if !ok {
+		return nil, false, nil
+	}
+
+	cache, err := ReadKerberosCache(path)
+	if err != nil {
+		return nil, true, err
+	}
+
+	tgt := cache.TGT()
+	if tgt == nil {
+		return nil, true, ErrNoKerberosTGT
+	}
+
+	return tgt, true, nil
+}
@@ -0,0 +1,123 @@
+package main
+
+import (
+	"io/ioutil"
+	"testing"
+	"time"
+)
+
+/**
+ * testdata/krb5cc_v4: alice@EXAMPLE.COM with a cache config entry, a service ticket, a cross-realm
+ * TGT and the local TGT, in that order.
+ * testdata/krb5cc_v3: the same principal with a service ticket and only a cross-realm TGT.
+ */
+
+func readFixture(t *testing.T, name string) []byte {
+	content, err := ioutil.ReadFile("testdata/" + name)
+	if err != nil {
+		t.Fatalf("Reading %v: %v", name, err)
+	}
+
+	return content
+}
+
+func TestParseKerberosCacheV4(t *testing.T) {
+	cache, err := ParseKerberosCache(readFixture(t, "krb5cc_v4"))
+	if err != nil {
+		t.Fatalf("Parsing: %v", err)
+	}
+
+	if cache.Principal.String() != "alice@EXAMPLE.COM" {
+		t.Errorf("Principal is %v", cache.Principal)
+	}
+
+	// The X-CACHECONF: entry is skipped
+	if len(cache.Credentials) != 3 {
+		t.Fatalf("Got %d credentials, expected 3", len(cache.Credentials))
+	}
+
+	for _, cred := range cache.Credentials {
+		if cred.Server.Realm == "X-CACHECONF:" {
+			t.Errorf("Cache config entry wasn't skipped: %v", cred.Server)
+		}
+	}
+
+	// The local TGT wins over the cross-realm one before it
+	tgt := cache.TGT()
+	if tgt == nil {
+		t.Fatal("No TGT")
+	}
+
+	if tgt.Server.String() != "krbtgt/EXAMPLE.COM@EXAMPLE.COM" {
+		t.Errorf("TGT is for %v", tgt.Server)
+	}
+
+	if !tgt.EndTime.Equal(time.Unix(1700036000, 0)) {
+		t.Errorf("TGT ends at %v", tgt.EndTime)
+	}
+
+	if !tgt.RenewTill.Equal(time.Unix(1700604800, 0)) {
+		t.Errorf("TGT renewable until %v", tgt.RenewTill)
+	}
+}
+
+func TestParseKerberosCacheV3(t *testing.T) {
+	cache, err := ParseKerberosCache(readFixture(t, "krb5cc_v3"))
+	if err != nil {
+		t.Fatalf("Parsing: %v", err)
+	}
+
+	if len(cache.Credentials) != 2 {
+		t.Fatalf("Got %d credentials, expected 2", len(cache.Credentials))
+	}
+
+	// Only a cross-realm TGT, which is better than nothing
+	tgt := cache.TGT()
+	if tgt == nil {
+		t.Fatal("No TGT")
+	}
+
+	if tgt.Server.String() != "krbtgt/OTHER.COM@OTHER.COM" {
+		t.Errorf("TGT is for %v", tgt.Server)
+	}
+
+	// No start time, so it's the auth time
+	if !tgt.StartTime.Equal(tgt.AuthTime) {
+		t.Errorf("Start time %v isn't the auth time %v", tgt.StartTime, tgt.AuthTime)
+	}
+}
+
+func TestParseKerberosCacheNoTGT(t *testing.T) {
+	cache, err := ParseKerberosCache(readFixture(t, "krb5cc_v3"))
+	if err != nil {
+		t.Fatalf("Parsing: %v", err)
+	}
+
+	// Drop the TGT
+	cache.Credentials = cache.Credentials[:1]
+
+	if tgt := cache.TGT(); tgt != nil {
+		t.Errorf("Found a TGT for %v in a cache without one", tgt.Server)
+	}
+}
+
+func TestParseKerberosCacheTruncated(t *testing.T) {
+	content := readFixture(t, "krb5cc_v4")
+
+	for _, length := range []int{0, 1, 3, 20, len(content) / 2, len(content) - 1} {
+		if _, err := ParseKerberosCache(content[:length]); err == nil {
+			t.Errorf("No error for a cache truncated to %d bytes", length)
+		}
+	}
+}
+
+func TestParseKerberosCacheUnsupportedVersion(t *testing.T) {
+	content := readFixture(t, "krb5cc_v4")
+
+	// Version 2 is in native byte order, which we don't read
+	content[1] = 0x02
+
+	if _, err := ParseKerberosCache(content); err == nil {
+		t.Error("No error for a version 2 cache")
+	}
+}
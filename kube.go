@@ -0,0 +1,126 @@
+package main
+
+/**
+ * Kubernetes context and namespace, read straight from the kubeconfig files
+ */
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/fatih/color"
+	"gopkg.in/yaml.v2"
+)
+
+type kubeConfigFile struct {
+	CurrentContext string `yaml:"current-context"`
+	Contexts       []struct {
+		Name    string `yaml:"name"`
+		Context struct {
+			Cluster   string `yaml:"cluster"`
+			Namespace string `yaml:"namespace"`
+		} `yaml:"context"`
+	} `yaml:"contexts"`
+}
+
+type KubeInfo struct {
+	Context   string
+	Namespace string
+}
+
+/**
+ * Kubeconfig files in the order kubectl reads them: $KUBECONFIG if set, otherwise ~/.kube/config.
+ */
+func kubeConfigPaths() []string {
+	paths := make([]string, 0)
+
+	if env := os.Getenv("KUBECONFIG"); len(env) > 0 {
+		for _, path := range filepath.SplitList(env) {
+			if len(path) > 0 {
+				paths = append(paths, path)
+			}
+		}
+	} else {
+		paths = append(paths, filepath.Join(HOME, ".kube/config"))
+	}
+
+	return paths
+}
+
+/**
+ * Loads the current context and its namespace, merging files the same way kubectl does (the first
+ * file to set a value wins).  Returns nil if there's no kubeconfig or no current context.
+ */
+func NewKubeInfo() *KubeInfo {
+	currentContext := ""
+	namespaces := map[string]string{}
+
+	for _, path := range kubeConfigPaths() {
+		content, err := ioutil.ReadFile(path)
+		if err != nil {
+			continue
+		}
+
+		var config kubeConfigFile
+		if yaml.Unmarshal(content, &config) != nil {
+			continue
+		}
+
+		if len(currentContext) == 0 {
+			currentContext = config.CurrentContext
+		}
+
+		for _, ctx := range config.Contexts {
+			if _, exists := namespaces[ctx.Name]; !exists {
+				namespaces[ctx.Name] = ctx.Context.Namespace
+			}
+		}
+	}
+
+	if len(currentContext) == 0 {
+		return nil
+	}
+
+	info := &KubeInfo{
+		Context:   currentContext,
+		Namespace: namespaces[currentContext],
+	}
+
+	if len(info.Namespace) == 0 {
+		info.Namespace = "default"
+	}
+
+	return info
+}
+
+/**
+ * Display name for a context, from "context = alias" lines in ~/.host/config/kube_aliases.
+ * EKS/GKE context names are long, this makes them something readable.
+ */
+func kubeContextAlias(context string) string {
+	for _, pair := range readHostConfigPairs("kube_aliases") {
+		if pair[0] == context {
+			return pair[1]
+		}
+	}
+
+	return context
+}
+
+func kubeContext() (string, string) {
+	info := NewKubeInfo()
+
+	if info == nil {
+		return "", ""
+	}
+
+	name := kubeContextAlias(info.Context)
+	str := "⎈" + name + ":" + info.Namespace
+
+	if isProduction(info.Context) || isProduction(name) {
+		return str, themeColor("kube-production", color.BgRed, color.FgHiWhite, color.Bold).Sprint(str)
+	} else {
+		return str, themeColor("kube", color.FgHiBlue).Sprint(str)
+	}
+}
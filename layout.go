@@ -0,0 +1,294 @@
+package main
+
+/**
+ * Lays out prompt segments on a line, shortening or dropping them when the terminal is too narrow.
+ */
+
+import (
+	"strings"
+)
+
+// Higher priority segments are kept longer when space runs out
+const (
+	PRIORITY_LOW      = 10
+	PRIORITY_NORMAL   = 50
+	PRIORITY_HIGH     = 90
+	PRIORITY_REQUIRED = 100 // Never dropped
+)
+
+const (
+	LINE_STYLE_PLAIN     = "plain"
+	LINE_STYLE_POWERLINE = "powerline"
+)
+
+type Segment struct {
+	Name     string
+	Priority int
+
+	Plain   string
+	Colored string
+
+	// Drawn around the segment, and dropped along with it
+	OpenPlain    string
+	OpenColored  string
+	ClosePlain   string
+	CloseColored string
+
+	// Shorter form, used before resorting to shrinking or dropping
+	CompactPlain   string
+	CompactColored string
+	hasCompact     bool
+
+	// Re-renders the segment into fewer columns (e.g. truncating a path), no narrower than MinWidth
+	Shrink   func(width int) (string, string)
+	MinWidth int
+
+	// Only drawn in the plain style (spacers, brackets, ...)
+	Decoration bool
+
+	// Drawn as part of the previous segment's block in the powerline style
+	Joined bool
+
+	isCompact  bool
+	shrunk     bool
+	cantShrink bool
+	dropped    bool
+}
+
+func NewSegment(name string, priority int, plain string, colored string) *Segment {
+	return &Segment{
+		Name:     name,
+		Priority: priority,
+		Plain:    plain,
+		Colored:  colored,
+	}
+}
+
+func NewDecoration(name string, plain string, colored string) *Segment {
+	s := NewSegment(name, PRIORITY_REQUIRED, plain, colored)
+	s.Decoration = true
+	return s
+}
+
+func (s *Segment) WithJoined() *Segment {
+	s.Joined = true
+	return s
+}
+
+func (s *Segment) WithCompact(plain string, colored string) *Segment {
+	s.CompactPlain = plain
+	s.CompactColored = colored
+	s.hasCompact = true
+	return s
+}
+
+func (s *Segment) WithBrackets(openPlain string, openColored string, closePlain string, closeColored string) *Segment {
+	s.OpenPlain = openPlain
+	s.OpenColored = openColored
+	s.ClosePlain = closePlain
+	s.CloseColored = closeColored
+	return s
+}
+
+func (s *Segment) WithShrink(minWidth int, shrink func(width int) (string, string)) *Segment {
+	s.MinWidth = minWidth
+	s.Shrink = shrink
+	return s
+}
+
+func (s *Segment) Visible() bool {
+	return !s.dropped && len(s.Plain) > 0
+}
+
+func (s *Segment) Width() int {
+	if s.Visible() {
+		return displayWidth(s.OpenPlain) + displayWidth(s.Plain) + displayWidth(s.ClosePlain)
+	} else {
+		return 0
+	}
+}
+
+func (s *Segment) Render() string {
+	if s.Visible() {
+		return s.OpenColored + s.Colored + s.CloseColored
+	} else {
+		return ""
+	}
+}
+
+func (s *Segment) canCompact() bool {
+	return s.Visible() && s.hasCompact && !s.isCompact
+}
+
+func (s *Segment) canShrink() bool {
+	return s.Visible() && s.Shrink != nil && !s.cantShrink && displayWidth(s.Plain) > s.MinWidth
+}
+
+func (s *Segment) canDrop() bool {
+	return s.Visible() && s.Priority < PRIORITY_REQUIRED
+}
+
+func (s *Segment) canShorten() bool {
+	return s.canCompact() || s.canShrink() || s.canDrop()
+}
+
+func (s *Segment) compact() {
+	s.Plain = s.CompactPlain
+	s.Colored = s.CompactColored
+	s.isCompact = true
+}
+
+/**
+ * Shrinks the segment's content (brackets not included) to the given width.
+ */
+func (s *Segment) shrink(width int) {
+	if width < s.MinWidth {
+		width = s.MinWidth
+	}
+
+	before := s.Width()
+
+	s.Plain, s.Colored = s.Shrink(width)
+	s.shrunk = true
+
+	if s.Width() >= before {
+		// Can't get any smaller
+		s.cantShrink = true
+	}
+}
+
+type Line struct {
+	Left  []*Segment
+	Right []*Segment
+
+	// Repeated between the left and right sides, always at least once
+	FillPlain   string
+	FillColored string
+
+	// LINE_STYLE_PLAIN or LINE_STYLE_POWERLINE
+	Style string
+}
+
+func (l *Line) segments() []*Segment {
+	return append(append([]*Segment{}, l.Left...), l.Right...)
+}
+
+/**
+ * How wide the line is with the minimum amount of fill.
+ */
+func (l *Line) Width() int {
+	if l.Style == LINE_STYLE_POWERLINE {
+		return powerlineWidth(l)
+	}
+
+	width := displayWidth(l.FillPlain)
+
+	for _, s := range l.segments() {
+		width += s.Width()
+	}
+
+	return width
+}
+
+/**
+ * Finds the lowest priority segment that passes the check.  Ties go to the rightmost segment.
+ */
+func (l *Line) lowestPriority(check func(s *Segment) bool) *Segment {
+	var lowest *Segment
+
+	for _, s := range l.segments() {
+		if check(s) && (lowest == nil || s.Priority <= lowest.Priority) {
+			lowest = s
+		}
+	}
+
+	return lowest
+}
+
+/**
+ * Shortens segments until the line fits in the width.  Lowest priority segments go first, so a
+ * segment is only shortened once everything below it has been dropped.  Within a priority, each step
+ * is tried on every segment before moving to the next:
+ *   1. Switch to the compact form
+ *   2. Shrink
+ *   3. Drop
+ */
+func (l *Line) Fit(width int) {
+	for l.Width() > width {
+		lowest := l.lowestPriority((*Segment).canShorten)
+		if lowest == nil {
+			// Nothing left to do, it's going to wrap
+			return
+		}
+
+		atPriority := func(check func(s *Segment) bool) func(s *Segment) bool {
+			return func(s *Segment) bool {
+				return s.Priority == lowest.Priority && check(s)
+			}
+		}
+
+		if s := l.lowestPriority(atPriority((*Segment).canCompact)); s != nil {
+			s.compact()
+		} else if s := l.lowestPriority(atPriority((*Segment).canShrink)); s != nil {
+			s.shrink(displayWidth(s.Plain) - (l.Width() - width))
+		} else {
+			l.lowestPriority(atPriority((*Segment).canDrop)).dropped = true
+		}
+	}
+
+	l.regrow(width)
+}
+
+/**
+ * Dropping a segment can free up more space than was needed, give it back to the shrunk segments.
+ */
+func (l *Line) regrow(width int) {
+	for _, s := range l.segments() {
+		spare := width - l.Width()
+		if spare <= 0 {
+			return
+		}
+
+		if !s.shrunk || !s.Visible() {
+			continue
+		}
+
+		plain, colored := s.Plain, s.Colored
+
+		s.Plain, s.Colored = s.Shrink(displayWidth(s.Plain) + spare)
+
+		if l.Width() > width {
+			s.Plain, s.Colored = plain, colored
+		}
+	}
+}
+
+/**
+ * Renders the line, filling the space between left and right to reach the width.
+ */
+func (l *Line) Render(width int) string {
+	if l.Style == LINE_STYLE_POWERLINE {
+		return renderPowerline(l, width)
+	}
+
+	var left, right strings.Builder
+
+	for _, s := range l.Left {
+		left.WriteString(s.Render())
+	}
+
+	for _, s := range l.Right {
+		right.WriteString(s.Render())
+	}
+
+	fillWidth := displayWidth(l.FillPlain)
+	fillRequired := 1
+	if fillWidth > 0 {
+		fillRequired = (width - (l.Width() - fillWidth)) / fillWidth
+	}
+	if fillRequired < 1 {
+		fillRequired = 1
+	}
+
+	return left.String() + strings.Repeat(l.FillColored, fillRequired) + right.String()
+}
@@ -0,0 +1,129 @@
+package main
+
+import (
+	"testing"
+)
+
+/**
+ * A segment that shrinks like the directory does, by cutting off the start of the path.
+ */
+func pathSegment(priority int, path string) *Segment {
+	shrink := func(width int) (string, string) {
+		if displayWidth(path) <= width {
+			return path, path
+		}
+
+		str := "…" + trimStartToWidth(path, width-1)
+		return str, str
+	}
+
+	return NewSegment("dir", priority, path, path).WithBrackets("{", "{", "}", "}").WithShrink(5, shrink)
+}
+
+func plainSegment(name string, priority int, str string) *Segment {
+	return NewSegment(name, priority, str, str)
+}
+
+func TestLineFit(t *testing.T) {
+	tests := []struct {
+		name     string
+		left     []*Segment
+		right    []*Segment
+		width    int
+		expected string
+	}{
+		{
+			"fits",
+			[]*Segment{plainSegment("user", PRIORITY_HIGH, "[me]")},
+			[]*Segment{pathSegment(PRIORITY_HIGH, "/src/prompt")},
+			24,
+			"[me]-------{/src/prompt}",
+		},
+		{
+			"compact first",
+			[]*Segment{plainSegment("time", PRIORITY_LOW, "14:12 | SEA 07:12").WithCompact("14:12", "14:12")},
+			[]*Segment{plainSegment("client", PRIORITY_LOW, "<client>")},
+			16,
+			"14:12---<client>",
+		},
+		{
+			"lower priority dropped before shrinking",
+			[]*Segment{
+				plainSegment("user", PRIORITY_HIGH, "[me]"),
+				plainSegment("client", PRIORITY_LOW, "<10.0.0.5>"),
+			},
+			[]*Segment{pathSegment(PRIORITY_HIGH, "/src/prompt")},
+			20,
+			"[me]---{/src/prompt}",
+		},
+		{
+			"shrink once lower priorities are gone",
+			[]*Segment{
+				plainSegment("user", PRIORITY_HIGH, "[me]"),
+				plainSegment("client", PRIORITY_LOW, "<10.0.0.5>"),
+			},
+			[]*Segment{pathSegment(PRIORITY_HIGH, "/home/me/src/prompt")},
+			18,
+			"[me]-{…src/prompt}",
+		},
+		{
+			"freed space goes back to the shrunk segment",
+			[]*Segment{pathSegment(PRIORITY_HIGH, "/home/me/src/prompt")},
+			[]*Segment{plainSegment("user", PRIORITY_HIGH, "[someone]")},
+			16,
+			"{…e/src/prompt}-",
+		},
+		{
+			"ties go to the rightmost",
+			[]*Segment{plainSegment("host", PRIORITY_NORMAL, "host")},
+			[]*Segment{plainSegment("kube", PRIORITY_NORMAL, "kube")},
+			6,
+			"host--",
+		},
+		{
+			"required segments stay, even if it wraps",
+			[]*Segment{NewDecoration("open", "-[", "-[")},
+			[]*Segment{plainSegment("exitcode", PRIORITY_NORMAL, "[1]"), NewDecoration("close", "]-", "]-")},
+			3,
+			"-[-]-",
+		},
+	}
+
+	for _, test := range tests {
+		line := &Line{Left: test.left, Right: test.right, FillPlain: "-", FillColored: "-", Style: LINE_STYLE_PLAIN}
+
+		line.Fit(test.width)
+
+		if actual := line.Render(test.width); actual != test.expected {
+			t.Errorf("%v: got %q, expected %q", test.name, actual, test.expected)
+		}
+	}
+}
+
+func TestLineRenderFill(t *testing.T) {
+	tests := []struct {
+		fill     string
+		width    int
+		expected string
+	}{
+		{"-", 12, "left---right"},
+		{"-", 9, "left-right"},
+		{"=-", 12, "left=-right"},
+		{"=-", 13, "left=-=-right"},
+		{" ", 10, "left right"},
+	}
+
+	for _, test := range tests {
+		line := &Line{
+			Left:        []*Segment{plainSegment("left", PRIORITY_REQUIRED, "left")},
+			Right:       []*Segment{plainSegment("right", PRIORITY_REQUIRED, "right")},
+			FillPlain:   test.fill,
+			FillColored: test.fill,
+			Style:       LINE_STYLE_PLAIN,
+		}
+
+		if actual := line.Render(test.width); actual != test.expected {
+			t.Errorf("%q at %d: got %q, expected %q", test.fill, test.width, actual, test.expected)
+		}
+	}
+}
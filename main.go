@@ -5,14 +5,10 @@ import (
 	"github.com/fatih/color"
 	"github.com/pborman/getopt/v2"
 	"github.com/wayneashleyberry/terminal-dimensions"
-	"io/ioutil"
 	"os"
-	"os/user"
 	"path/filepath"
 	"strconv"
 	"strings"
-	"time"
-	"unicode/utf8"
 )
 
 var DEFAULT *color.Color
@@ -27,8 +23,6 @@ var RANBRACKET string
 var HOME = os.ExpandEnv("$HOME")
 
 var WIDTH int
-var FIRST_LINE_WIDTH_AVAILABLE int
-var SECOND_LINE_WIDTH_AVAILABLE int
 
 var EXIT_CODE int
 var WORKING_DIRECTORY string
@@ -37,6 +31,9 @@ var HAS_SUSPENDED_JOBS bool
 var SHOW_BATTERY bool
 var VCS_STATUS_CMD string
 var WD_FORMAT_CMD string
+var PART string
+var TRANSIENT bool
+var LINE_STYLES []string
 
 type VCSInfo struct {
 	Branch string
@@ -44,27 +41,50 @@ type VCSInfo struct {
 }
 
 func username() (string, string) {
-	curUser, userErr := user.Current()
-	if userErr != nil {
-		return "!user!", color.HiRedString("!user!")
-	} else {
-		userName := curUser.Username
+	info := NewPrivilegeInfo()
 
-		if userName == "root" {
-			return userName, color.HiYellowString(userName)
-		} else {
-			return userName, color.CyanString(userName)
-		}
+	userName := info.User
+	userColor := themeColor("user", color.FgCyan)
+
+	if userName == "root" {
+		userColor = themeColor("user-root", color.FgHiYellow)
+	} else if len(info.Groups) > 0 {
+		// Root in all but name
+		userColor = themeColor("user-privileged", color.FgHiCyan, color.Bold)
 	}
+
+	str := userName
+	colored := userColor.Sprint(userName)
+
+	// A setuid shell, we're really someone else
+	if len(info.RealUser) > 0 {
+		prefix := info.RealUser + "→"
+		str = prefix + str
+		colored = themeColor("user-setuid", color.FgHiRed, color.Bold).Sprint(prefix) + colored
+	}
+
+	// Show who we were before sudo -s/su
+	if len(info.OriginalUser) > 0 {
+		prefix := info.OriginalUser + "→"
+		str = prefix + str
+		colored = themeColor("user-sudo", color.FgYellow).Sprint(prefix) + colored
+	}
+
+	return str, colored
 }
 
 func atjobs() (string, string) {
-	c := color.New(color.FgCyan)
+	c := themeColor("jobs", color.FgCyan)
+
+	if JOB_STYLE != JOB_STYLE_AT {
+		// The jobs have their own segment
+		return "@", c.Sprint("@")
+	}
 
 	if HAS_SUSPENDED_JOBS {
-		c = color.New(color.FgHiRed, color.Bold)
+		c = themeColor("jobs-suspended", color.FgHiRed, color.Bold)
 	} else if HAS_RUNNING_JOBS {
-		c = color.New(color.FgHiGreen, color.Bold)
+		c = themeColor("jobs-running", color.FgHiGreen, color.Bold)
 	}
 
 	return "@", c.Sprint("@")
@@ -74,34 +94,25 @@ func hostload() (string, string) {
 
 	// Get hostname
 
-	hostName, hostErr := os.Hostname()
-	if hostErr != nil {
-		hostName = "!host!"
-	}
-
-	prettyName, _, prettyNameErr := execAndGetOutput("pretty-hostname", nil)
-
-	if prettyNameErr == nil {
-		hostName = prettyName
-	}
-
-	hostName = strings.TrimSpace(hostName)
+	hostName, loadColor := hostIdentity()
 
 	// Get load
-	loadColor := color.New(color.FgCyan)
 	info := NewCPUInfo()
+	settings := loadSettings()
+	load, loadPercentage := info.Load(settings.Average)
 
-	if info.Load1MinPercentage > 1.00 {
-		loadColor = color.New(color.BgRed, color.FgHiWhite, color.Bold)
-		hostName = fmt.Sprintf("%s(%0.2f)", hostName, info.Load1Min)
-	} else if info.Load1MinPercentage > 0.75 {
-		loadColor = color.New(color.FgHiRed, color.Bold)
-		hostName = fmt.Sprintf("%s(%0.2f)", hostName, info.Load1Min)
-	} else if info.Load1MinPercentage > 0.50 {
-		loadColor = color.New(color.FgHiMagenta, color.Bold)
-		hostName = fmt.Sprintf("%s(%0.2f)", hostName, info.Load1Min)
-	} else if info.Load1MinPercentage > 0.25 {
-		loadColor = color.New(color.FgHiYellow, color.Bold)
+	if loadPercentage > settings.Critical {
+		loadColor = themeColor("load-critical", color.BgRed, color.FgHiWhite, color.Bold)
+	} else if loadPercentage > settings.High {
+		loadColor = themeColor("load-high", color.FgHiRed, color.Bold)
+	} else if loadPercentage > settings.Medium {
+		loadColor = themeColor("load-medium", color.FgHiMagenta, color.Bold)
+	} else if loadPercentage > settings.Low {
+		loadColor = themeColor("load-low", color.FgHiYellow, color.Bold)
+	}
+
+	if loadPercentage > settings.Show {
+		hostName = fmt.Sprintf("%s(%0.2f%s)", hostName, load, info.Trend())
 	}
 
 	return hostName, loadColor.Sprint(hostName)
@@ -112,14 +123,17 @@ func cwd(dirWidthAvailable int) (string, string) {
 	if WORKING_DIRECTORY == "" {
 		// Invalid working directory
 		badDirStr := "<missing>"
-		invalidDirColor := color.New(color.FgHiRed, color.Bold, color.BlinkSlow)
+		invalidDirColor := themeColor("dir-missing", color.FgHiRed, color.Bold, color.BlinkSlow)
 		return badDirStr, invalidDirColor.Sprint(badDirStr)
 	}
 
 	var homePath = WORKING_DIRECTORY
 
-	// If a WD_FORMAT_CMD is specified, run our path through that
-	if WD_FORMAT_CMD != "" {
+	if ws := currentWorkspace(); ws != nil {
+		// Relative to the package, the workspace segment says which one
+		homePath = ws.RelativePath(WORKING_DIRECTORY)
+	} else if WD_FORMAT_CMD != "" {
+		// If a WD_FORMAT_CMD is specified, run our path through that
 		output, _, err := execAndGetOutput(WD_FORMAT_CMD, &WORKING_DIRECTORY, homePath)
 
 		if err == nil {
@@ -148,7 +162,7 @@ func cwd(dirWidthAvailable int) (string, string) {
 	homePath = truncateAndEllipsisAtStart(homePath, dirWidthAvailable)
 
 	// Figure out directory color
-	dirColor := color.New(color.FgHiGreen)
+	dirColor := themeColor("dir", color.FgHiGreen)
 
 	// Check writable
 	// Writable checks unsupported right now... :(
@@ -183,11 +197,11 @@ func cwd(dirWidthAvailable int) (string, string) {
 				} else {
 					// Finally!  Color according to space left
 					if perc > 90 {
-						dirColor = color.New(color.BgRed, color.FgHiWhite, color.Bold)
+						dirColor = themeColor("dir-full-critical", color.BgRed, color.FgHiWhite, color.Bold)
 					} else if perc > 80 {
-						dirColor = color.New(color.FgHiRed, color.Bold)
+						dirColor = themeColor("dir-full-high", color.FgHiRed, color.Bold)
 					} else if perc > 70 {
-						dirColor = color.New(color.FgHiYellow, color.Bold)
+						dirColor = themeColor("dir-full-medium", color.FgHiYellow, color.Bold)
 					}
 				}
 			} else {
@@ -210,9 +224,20 @@ func cwd(dirWidthAvailable int) (string, string) {
 	return homePath, dirColor.Sprint(homePath)
 }
 
-func curtime() (string, string) {
-	t := time.Now().Local().Format("15:04")
-	return t, color.YellowString(t)
+/**
+ * line:    which line the clock is on (prompt, right or transient), for its clock settings
+ */
+func curtime(line string) (string, string, string, string) {
+	settings := clockSettings(line)
+	tme, tmeColor := clock(settings)
+
+	// Without the extra zones, for when there's no room
+	if len(settings.Zones) > 0 && settings.Local {
+		settings.Zones = nil
+	}
+	compact, compactColor := clock(settings)
+
+	return tme, tmeColor, compact, compactColor
 }
 
 func battery() (string, string) {
@@ -220,7 +245,7 @@ func battery() (string, string) {
 		battInfo, err := NewBatteryInfo()
 
 		if err != nil {
-			return "<!bat!>", color.HiRedString("<!bat!>")
+			return "<!bat!>", themeColor("battery-error", color.FgHiRed).Sprint("<!bat!>")
 		} else {
 			if battInfo.Percent > 99 {
 				// Display nothing
@@ -247,8 +272,8 @@ func battery() (string, string) {
 
 func getErrorCode() (string, string) {
 	if EXIT_CODE != 0 {
-		errStr := fmt.Sprintf(" :%d:", EXIT_CODE)
-		return errStr, color.HiRedString(errStr)
+		errStr := fmt.Sprintf(":%d:", EXIT_CODE)
+		return errStr, themeColor("exitcode", color.FgHiRed).Sprint(errStr)
 	} else {
 		return "", ""
 	}
@@ -257,89 +282,21 @@ func getErrorCode() (string, string) {
 func getLoginCert() (string, string) {
 	// General purpose login info
 	flags := make([]string, 0)
+	flagsColor := make([]string, 0)
 
-	kerberos, _ := getKerberos()
-	if len(kerberos) > 0 {
-		flags = append(flags, strings.TrimSpace(kerberos))
-	}
-	midway, _ := getMidwayCert()
-	if len(midway) > 0 {
-		flags = append(flags, strings.TrimSpace(midway))
-	}
-
-	path := filepath.Join(HOME, ".host/config/login_certs")
-	if fileExists(path) {
-		fileInfo, err := ioutil.ReadDir(path)
-		if err == nil {
-			for _, file := range fileInfo {
-				if file.Mode().IsDir() {
-					continue
-				}
-
-				perm := file.Mode().Perm() & (^os.ModeType)
-				isExec := (perm & 0111) != 0
+	for _, check := range credentialChecks() {
+		flag, flagColor := check.Check().Flag()
 
-				if !isExec {
-					continue
-				}
-
-				// Run the command and save the output
-				cmd := filepath.Join(path, file.Name())
-				output, _, _ := execAndGetOutput(cmd, nil, "")
-				output = strings.TrimSpace(output)
-
-				if len(output) > 0 {
-					flags = append(flags, strings.TrimSpace(output))
-				}
-			}
+		if len(flag) > 0 {
+			flags = append(flags, flag)
+			flagsColor = append(flagsColor, flagColor)
 		}
 	}
 
 	if len(flags) > 0 {
-		s := " [" + strings.Join(flags, " ") + "]"
-		return s, color.New(color.FgHiRed, color.Bold).Sprint(s)
-	} else {
-		return "", ""
-	}
-}
-
-func getKerberos() (string, string) {
-	// See if we even care (flag in host config)
-	path := filepath.Join(HOME, ".host/config/check_kerberos")
-	if fileExists(path) {
-		// Do we have a ticket?
-		_, exitCode, _ := execAndGetOutput("klist", nil, "-s")
-
-		hasTicket := exitCode == 0
-
-		if hasTicket {
-			return "", ""
-		} else {
-			return "K", color.New(color.FgHiRed, color.Bold).Sprint("K")
-		}
-	} else {
-		return "", ""
-	}
-}
-
-func getMidwayCert() (string, string) {
-	// See if we even care (flag in host config)
-	path := filepath.Join(HOME, ".host/config/check_midway")
-	if fileExists(path) {
-		// Do we have a cert?
-		output, exitCode, _ := execAndGetOutput("mwinit", nil, "-l")
-
-		hasCert := exitCode == 0
-
-		if hasCert {
-			hasCert = len(output) > 0
-		}
-
-		if hasCert {
-			return "", ""
-		} else {
-			return "M", color.New(color.FgHiRed, color.Bold).Sprint("M")
-		}
+		c := themeColor("login-cert", color.FgHiRed, color.Bold)
+		return "[" + strings.Join(flags, " ") + "]",
+			c.Sprint("[") + strings.Join(flagsColor, " ") + c.Sprint("]")
 	} else {
 		return "", ""
 	}
@@ -376,7 +333,7 @@ func getVCSInfo(workingdir *string) *VCSInfo {
 	}
 
 	return &VCSInfo{
-		Branch: "   " + strings.TrimSpace(lines[0]),
+		Branch: strings.TrimSpace(lines[0]),
 		Files:  strings.TrimSpace(lines[1]),
 	}
 }
@@ -419,17 +376,47 @@ func parseOptions() {
 	width := getopt.IntLong("width", 'w', 0,
 		"Override detected terminal width.")
 
+	ambiguousWidth := getopt.IntLong("ambiwidth", 0, AMBIGUOUS_WIDTH,
+		"How many columns (1 or 2) the terminal uses for East Asian characters of ambiguous width.")
+
 	hasrunningjobs := getopt.BoolLong("runningjobs", 'r',
 		"Flag that indicates if the shell has background jobs running.")
 	hassuspendedjobs := getopt.BoolLong("suspendedjobs", 's',
 		"Flag that indicates if the shell has background jobs that are suspended.")
 
+	jobs := getopt.StringLong("jobs", 0, "",
+		"How many background jobs the shell has: RUNNING[,SUSPENDED].")
+
+	jobNames := getopt.StringLong("jobnames", 0, "",
+		"What the background jobs are, comma separated: running:make,suspended:vim.")
+
+	jobStyle := getopt.EnumLong("jobstyle", 0, []string{JOB_STYLE_COUNT, JOB_STYLE_AT}, JOB_STYLE,
+		"How to show background jobs: count (after the host), or at (the color of the @).")
+
 	showBattery := getopt.BoolLong("showBattery", 'b',
 		"Should we attempt to show battery data on the prompt.")
 
 	forcecolor := getopt.BoolLong("color", 'c',
 		"Force colored output.")
 
+	part := getopt.EnumLong("part", 0, []string{"full", "left", "right"}, "full",
+		"Which part of the prompt to print: full, or left/right for shells that do a separate right prompt.")
+
+	transient := getopt.BoolLong("transient", 't',
+		"Print the short one line prompt that replaces the full one after a command is run.")
+
+	style := getopt.StringLong("style", 0, LINE_STYLE_PLAIN,
+		"How to draw the prompt: plain or powerline.  Comma separate to pick a style for each line.")
+
+	separators := getopt.EnumLong("separators", 0, []string{"nerd", "ascii"}, POWERLINE_SEPARATORS,
+		"Separators for the powerline style: nerd (needs a Powerline/Nerd Font) or ascii.")
+
+	shellName := getopt.EnumLong("shell", 0, []string{"", "zsh", "bash", "fish"}, "",
+		"The shell displaying the prompt, so non-printing characters can be marked for it.")
+
+	colorDepth := getopt.StringLong("colors", 0, "auto",
+		"How many colors the terminal supports: 16, 256, truecolor, or auto to detect.")
+
 	//
 	// Parse
 	//
@@ -438,16 +425,31 @@ func parseOptions() {
 
 	EXIT_CODE = *exitcode
 	WIDTH = *width
-	HAS_RUNNING_JOBS = *hasrunningjobs
-	HAS_SUSPENDED_JOBS = *hassuspendedjobs
+	setAmbiguousWidth(*ambiguousWidth)
+	RUNNING_JOBS, SUSPENDED_JOBS = parseJobCounts(*jobs)
+	RUNNING_JOB_NAMES, SUSPENDED_JOB_NAMES = parseJobNames(*jobNames)
+	HAS_RUNNING_JOBS = *hasrunningjobs || RUNNING_JOBS > 0 || len(RUNNING_JOB_NAMES) > 0
+	HAS_SUSPENDED_JOBS = *hassuspendedjobs || SUSPENDED_JOBS > 0 || len(SUSPENDED_JOB_NAMES) > 0
+	JOB_STYLE = *jobStyle
 	SHOW_BATTERY = *showBattery
 	VCS_STATUS_CMD = *vcscmd
 	WD_FORMAT_CMD = *wdFormatCmd
+	PART = *part
+	TRANSIENT = *transient
+	LINE_STYLES = strings.Split(*style, ",")
+	POWERLINE_SEPARATORS = *separators
+	SHELL_NAME = *shellName
 
 	if *forcecolor {
 		color.NoColor = false
 	}
 
+	if depth, ok := parseColorDepth(*colorDepth); ok {
+		COLOR_DEPTH = depth
+	} else {
+		COLOR_DEPTH = detectColorDepth()
+	}
+
 	//
 	// Validate results
 	//
@@ -469,9 +471,32 @@ func parseOptions() {
 	}
 }
 
+/**
+ * Style for a line of the prompt.  The last style given applies to any lines after it.
+ */
+func lineStyle(line int) string {
+	if len(LINE_STYLES) == 0 {
+		return LINE_STYLE_PLAIN
+	}
+
+	if line >= len(LINE_STYLES) {
+		line = len(LINE_STYLES) - 1
+	}
+
+	if strings.TrimSpace(LINE_STYLES[line]) == LINE_STYLE_POWERLINE {
+		return LINE_STYLE_POWERLINE
+	} else {
+		return LINE_STYLE_PLAIN
+	}
+}
+
 func setupDefaults() {
+	HOME = os.ExpandEnv("$HOME")
+
+	loadTheme()
+
 	// Colors need to happen after command line options to force color
-	DEFAULT = color.New(color.FgGreen)
+	DEFAULT = themeColor("default", color.FgGreen)
 	SPACER = DEFAULT.Sprint("-")
 	LSQBRACKET = DEFAULT.Sprint("[")
 	RSQBRACKET = DEFAULT.Sprint("]")
@@ -479,156 +504,322 @@ func setupDefaults() {
 	RBRACE = DEFAULT.Sprint("}")
 	LANBRACKET = DEFAULT.Sprint("<")
 	RANBRACKET = DEFAULT.Sprint(">")
+}
 
-	HOME = os.ExpandEnv("$HOME")
+func buildFirstLine() *Line {
+	usr, usrColor := username()
+	jobs, jobsColor := atjobs()
+	host, hostColor := hostload()
+	client, clientColor := sessionClient()
+	agent, agentColor := agentForwarding()
+
+	ws, wsColor := workspace()
+
+	// The directory gets whatever space is left over, down to a minimum
+	dir, dirColor := cwd(WIDTH)
+
+	return &Line{
+		Left: []*Segment{
+			NewDecoration("open", "-[", SPACER+LSQBRACKET),
+			NewSegment("user", PRIORITY_HIGH, usr, usrColor),
+			// The @ goes with the host, it's just noise without it
+			NewSegment("host", PRIORITY_NORMAL, jobs+host, jobsColor+hostColor).WithJoined(),
+			virtSegment(),
+			NewSegment("client", PRIORITY_LOW, client, clientColor).WithJoined(),
+			NewSegment("agent-forwarded", PRIORITY_HIGH, agent, agentColor).WithJoined(),
+			jobCountSegment(),
+			NewDecoration("close", "]-", RSQBRACKET+SPACER),
+		},
+		Right: []*Segment{
+			// Same priority as dir, which is relative to the workspace and misleading without it
+			NewSegment("workspace", PRIORITY_HIGH, ws, wsColor).
+				WithBrackets("-<", SPACER+LANBRACKET, ">", RANBRACKET),
+			NewSegment("dir", PRIORITY_HIGH, dir, dirColor).
+				WithBrackets("-{", SPACER+LBRACE, "}-", RBRACE+SPACER).
+				WithShrink(8, cwd),
+		},
+		FillPlain:   "-",
+		FillColored: SPACER,
+		Style:       lineStyle(0),
+	}
 }
 
-func main() {
+func jobCountSegment() *Segment {
+	if JOB_STYLE != JOB_STYLE_COUNT {
+		return NewSegment("job-count", PRIORITY_HIGH, "", "")
+	}
 
-	//////////////////
-	// Options/Setup
-	//////////////////
+	jobs, jobsColor, compact, compactColor := jobCounts()
 
-	parseOptions()
+	return NewSegment("job-count", PRIORITY_HIGH, jobs, jobsColor).
+		WithCompact(compact, compactColor).
+		WithBrackets(" ", " ", "", "")
+}
 
-	setupDefaults()
+func virtSegment() *Segment {
+	virt, virtColor, container := virtualization()
 
-	//////////////////
-	// FIRST LINE
-	//////////////////
+	// Being in a container matters more than being on a VM, which is most hosts these days
+	priority := PRIORITY_LOW
+	if container {
+		priority = PRIORITY_NORMAL
+	}
 
-	FIRST_LINE_WIDTH_AVAILABLE = WIDTH
+	return NewSegment("virt", priority, virt, virtColor).WithJoined()
+}
 
-	// Leading space/bracket
-	fmt.Print(SPACER + LSQBRACKET)
-	FIRST_LINE_WIDTH_AVAILABLE -= 2
+func timeSegment(line string) *Segment {
+	tme, tmeColor, compact, compactColor := curtime(line)
+	return NewSegment("time", PRIORITY_LOW, tme, tmeColor).WithCompact(compact, compactColor)
+}
 
-	// Username
-	usr, usrColor := username()
-	fmt.Print(usrColor)
-	FIRST_LINE_WIDTH_AVAILABLE -= utf8.RuneCountInString(usr)
+func batterySegment() *Segment {
+	batt, battColor := battery()
+	return NewSegment("battery", PRIORITY_LOW, batt, battColor)
+}
 
-	// Active jobs
-	jobs, jobsColor := atjobs()
-	fmt.Print(jobsColor)
-	FIRST_LINE_WIDTH_AVAILABLE -= utf8.RuneCountInString(jobs)
+func loginCertSegment() *Segment {
+	loginCerts, loginCertsColor := getLoginCert()
+	return NewSegment("login-cert", PRIORITY_HIGH, loginCerts, loginCertsColor).WithBrackets(" ", " ", "", "")
+}
 
-	// Hostname and CPU load
-	host, hostColor := hostload()
-	fmt.Print(hostColor)
-	FIRST_LINE_WIDTH_AVAILABLE -= utf8.RuneCountInString(host)
+func exitCodeSegment() *Segment {
+	errCode, errCodeColor := getErrorCode()
+	return NewSegment("exitcode", PRIORITY_HIGH, errCode, errCodeColor).WithBrackets(" ", " ", "", "")
+}
 
-	// Trailing bracket/space
-	fmt.Print(RSQBRACKET + SPACER)
-	FIRST_LINE_WIDTH_AVAILABLE -= 2
+func kubeSegment() *Segment {
+	kube, kubeColor := kubeContext()
+	return NewSegment("kube", PRIORITY_NORMAL, kube, kubeColor).WithBrackets(" ", " ", "", "")
+}
+
+func awsSegment() *Segment {
+	aws, awsColor := awsProfile()
+	return NewSegment("aws", PRIORITY_NORMAL, aws, awsColor).WithBrackets(" ", " ", "", "")
+}
 
-	// Load working directory information
-	dir, dirColor := cwd(FIRST_LINE_WIDTH_AVAILABLE - (1 + 2 + 2))
+func dockerSegment() *Segment {
+	docker, dockerColor := dockerInfo()
+	return NewSegment("docker", PRIORITY_NORMAL, docker, dockerColor).WithBrackets(" ", " ", "", "")
+}
+
+func composeSegment() *Segment {
+	compose, composeColor := composeInfo()
+	return NewSegment("compose", PRIORITY_LOW, compose, composeColor).WithBrackets(" ", " ", "", "")
+}
 
-	// Spaces needed for directory line
-	spacersRequired := FIRST_LINE_WIDTH_AVAILABLE - (2 + utf8.RuneCountInString(dir) + 2)
-	if spacersRequired < 1 {
-		spacersRequired = 1
+func cloudSegment() *Segment {
+	cloud, cloudColor := cloudEnvironment()
+	return NewSegment("cloud", PRIORITY_NORMAL, cloud, cloudColor).WithBrackets(" ", " ", "", "")
+}
+
+func shellSegment() *Segment {
+	shell, shellColor := shellNesting()
+	return NewSegment("shell", PRIORITY_LOW, shell, shellColor).WithBrackets(" ", " ", "", "")
+}
+
+func pythonSegment() *Segment {
+	python, pythonColor := pythonEnv()
+	return NewSegment("python", PRIORITY_LOW, python, pythonColor).WithBrackets(" ", " ", "", "")
+}
+
+func toolchainSegments() []*Segment {
+	segments := make([]*Segment, 0)
+
+	for _, toolchain := range TOOLCHAINS {
+		version, versionColor := toolchainVersion(toolchain)
+		segments = append(segments,
+			NewSegment("toolchain-"+toolchain.Name, PRIORITY_LOW, version, versionColor).WithBrackets(" ", " ", "", ""))
 	}
-	firstLineDynamicSpace := strings.Repeat(SPACER, spacersRequired)
 
-	fmt.Print(firstLineDynamicSpace)
-	FIRST_LINE_WIDTH_AVAILABLE -= spacersRequired
+	return segments
+}
 
-	// Leading space/brace
-	fmt.Print(SPACER + LBRACE)
-	FIRST_LINE_WIDTH_AVAILABLE -= 2
+/**
+ * Gets the VCS branch and file status segments, or nil if we're not in a repository.
+ */
+func vcsSegments() (*Segment, *Segment) {
+	if WORKING_DIRECTORY == "" {
+		return nil, nil
+	}
 
-	// Current directory
-	fmt.Print(dirColor)
-	FIRST_LINE_WIDTH_AVAILABLE -= utf8.RuneCountInString(dir)
+	vcsInfo := getVCSInfo(&WORKING_DIRECTORY)
 
-	// Trailing brace/space
-	fmt.Print(RBRACE + SPACER)
-	FIRST_LINE_WIDTH_AVAILABLE -= 2
+	if vcsInfo == nil {
+		return nil, nil
+	}
 
-	fmt.Println()
+	return NewSegment("vcs-branch", PRIORITY_NORMAL, stripANSI(vcsInfo.Branch), vcsInfo.Branch).WithBrackets("   ", "   ", "", ""),
+		NewSegment("vcs-files", PRIORITY_NORMAL, stripANSI(vcsInfo.Files), vcsInfo.Files)
+}
 
-	//////////////////
-	// SECOND LINE
-	//////////////////
+func buildSecondLine() *Line {
+	line := &Line{
+		Left: []*Segment{
+			NewDecoration("open", "--", SPACER+SPACER),
+			timeSegment("prompt"),
+			batterySegment(),
+			loginCertSegment(),
+			exitCodeSegment(),
+			shellSegment(),
+			kubeSegment(),
+			awsSegment(),
+			dockerSegment(),
+			composeSegment(),
+			cloudSegment(),
+			pythonSegment(),
+		},
+		Right: []*Segment{
+			NewDecoration("close", " --", " "+SPACER+SPACER),
+		},
+		FillPlain:   " ",
+		FillColored: " ",
+		Style:       lineStyle(1),
+	}
+
+	line.Left = append(line.Left, toolchainSegments()...)
+
+	// Branch on the left, file status on the right
+	branch, files := vcsSegments()
+
+	if branch != nil {
+		line.Left = append(line.Left, branch)
+		line.Right = append([]*Segment{files}, line.Right...)
+	}
+
+	return line
+}
 
-	SECOND_LINE_WIDTH_AVAILABLE = WIDTH
+/**
+ * Second line when the shell is showing a separate right prompt.  The time, battery and file status
+ * move to the right prompt, and there's no fill since the shell takes care of alignment.
+ */
+func buildSecondLeftLine() *Line {
+	line := &Line{
+		Left: []*Segment{
+			NewDecoration("open", "--", SPACER+SPACER),
+			loginCertSegment(),
+			exitCodeSegment(),
+			shellSegment(),
+			kubeSegment(),
+			awsSegment(),
+			dockerSegment(),
+			composeSegment(),
+			cloudSegment(),
+			pythonSegment(),
+		},
+		Right: []*Segment{
+			NewDecoration("close", " ", " "),
+		},
+		Style: lineStyle(1),
+	}
+
+	line.Left = append(line.Left, toolchainSegments()...)
+
+	branch, _ := vcsSegments()
+
+	if branch != nil {
+		line.Left = append(line.Left, branch)
+	}
+
+	return line
+}
 
-	// Initial spacers
-	fmt.Print(SPACER + SPACER)
-	SECOND_LINE_WIDTH_AVAILABLE -= 2
+func buildRightLine() *Line {
+	line := &Line{
+		Right: []*Segment{
+			timeSegment("right"),
+			batterySegment(),
+		},
+		Style: lineStyle(1),
+	}
 
-	// Current time
-	tme, tmeColor := curtime()
-	fmt.Print(tmeColor)
-	SECOND_LINE_WIDTH_AVAILABLE -= utf8.RuneCountInString(tme)
+	_, files := vcsSegments()
 
-	// Battery status
-	batt, battColor := battery()
-	if len(batt) > 0 {
-		fmt.Print(battColor)
-		SECOND_LINE_WIDTH_AVAILABLE -= utf8.RuneCountInString(batt)
+	if files != nil {
+		line.Right = append([]*Segment{files.WithBrackets("", "", " ", " ")}, line.Right...)
 	}
 
-	// Login cert/ticket status
-	loginCerts, loginCertsColor := getLoginCert()
-	if len(loginCerts) > 0 {
-		fmt.Print(loginCertsColor)
-		SECOND_LINE_WIDTH_AVAILABLE -= utf8.RuneCountInString(loginCerts)
+	return line
+}
+
+/**
+ * Minimal one line prompt that replaces the full one in scrollback once a command is accepted.
+ */
+func buildTransientLine() *Line {
+	promptColor := themeColor("transient-prompt", color.FgGreen, color.Bold)
+	if EXIT_CODE != 0 {
+		promptColor = themeColor("transient-prompt-error", color.FgHiRed, color.Bold)
 	}
 
-	// Error code from last command
-	errCode, errCodeColor := getErrorCode()
-	if len(errCode) > 0 {
-		fmt.Print(errCodeColor)
-		SECOND_LINE_WIDTH_AVAILABLE -= utf8.RuneCountInString(errCode)
+	return &Line{
+		Left: []*Segment{
+			timeSegment("transient"),
+			exitCodeSegment(),
+			NewSegment("prompt", PRIORITY_REQUIRED, " ❯ ", " "+promptColor.Sprint("❯")+" "),
+		},
+		Style: lineStyle(1),
 	}
+}
 
-	// Load vcs info
-	if WORKING_DIRECTORY != "" {
-		vcsInfo := getVCSInfo(&WORKING_DIRECTORY)
+func main() {
 
-		if vcsInfo != nil {
-			branchColor := vcsInfo.Branch
-			branch := stripANSI(branchColor)
+	//////////////////
+	// Options/Setup
+	//////////////////
 
-			filesColor := vcsInfo.Files
-			files := stripANSI(filesColor)
+	parseOptions()
 
-			// Branch line
-			fmt.Print(branchColor)
-			SECOND_LINE_WIDTH_AVAILABLE -= utf8.RuneCountInString(branch)
+	setupDefaults()
 
-			// Spacers with the file status on the right side
-			spacersRequired := SECOND_LINE_WIDTH_AVAILABLE - (utf8.RuneCountInString(files) + 3)
-			if spacersRequired < 1 {
-				spacersRequired = 1
-			}
-			secondLineDynamicSpace := strings.Repeat(" ", spacersRequired)
+	//////////////////
+	// Transient prompt
+	//////////////////
 
-			fmt.Print(secondLineDynamicSpace)
-			SECOND_LINE_WIDTH_AVAILABLE -= spacersRequired
+	if TRANSIENT {
+		transientLine := buildTransientLine()
+		transientLine.Fit(WIDTH)
+		printColored(transientLine.Render(WIDTH))
 
-			// File status
-			fmt.Print(filesColor)
-			SECOND_LINE_WIDTH_AVAILABLE -= utf8.RuneCountInString(files)
-		} else {
-			// Spacers without anything on the right side
-			spacersRequired := SECOND_LINE_WIDTH_AVAILABLE - (3)
-			if spacersRequired < 1 {
-				spacersRequired = 1
-			}
-			secondLineDynamicSpace := strings.Repeat(" ", spacersRequired)
+		return
+	}
 
-			fmt.Print(secondLineDynamicSpace)
-			SECOND_LINE_WIDTH_AVAILABLE -= spacersRequired
-		}
+	//////////////////
+	// Right prompt
+	//////////////////
+
+	if PART == "right" {
+		// Single line, the shell puts it on the last line of the left prompt
+		rightLine := buildRightLine()
+		rightLine.Fit(WIDTH)
+		printColored(rightLine.Render(WIDTH))
+
+		return
+	}
+
+	//////////////////
+	// FIRST LINE
+	//////////////////
+
+	firstLine := buildFirstLine()
+	firstLine.Fit(WIDTH)
+	printColored(firstLine.Render(WIDTH))
+
+	fmt.Println()
+
+	//////////////////
+	// SECOND LINE
+	//////////////////
+
+	var secondLine *Line
+	if PART == "left" {
+		secondLine = buildSecondLeftLine()
+	} else {
+		secondLine = buildSecondLine()
 	}
 
-	// Right spacers
-	fmt.Print(" " + SPACER + SPACER)
-	SECOND_LINE_WIDTH_AVAILABLE -= 3
+	secondLine.Fit(WIDTH)
+	printColored(secondLine.Render(WIDTH))
 
 	fmt.Println()
 }
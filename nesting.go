@@ -0,0 +1,104 @@
+package main
+
+/**
+ * Nested shells: how deep we are, which shell this is, and environments layered on by nix-shell,
+ * direnv or a terminal recording
+ */
+
+import (
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/fatih/color"
+)
+
+// Show SHLVL when it's above this, override with ~/.host/config/shlvl_threshold
+var DEFAULT_SHLVL_THRESHOLD = 1
+
+var KNOWN_SHELLS = []string{"bash", "zsh", "fish", "sh", "dash", "ksh", "mksh", "tcsh", "csh", "nu", "elvish", "xonsh"}
+
+func shellLevelThreshold() int {
+	lines := readHostConfigLines("shlvl_threshold")
+
+	if len(lines) > 0 {
+		if threshold, err := strconv.Atoi(lines[0]); err == nil {
+			return threshold
+		}
+	}
+
+	return DEFAULT_SHLVL_THRESHOLD
+}
+
+/**
+ * The shell running us, from --shell or our parent process.  Empty if our parent isn't a shell.
+ */
+func currentShell() string {
+	if len(SHELL_NAME) > 0 {
+		return SHELL_NAME
+	}
+
+	ancestors := processAncestors()
+	if len(ancestors) == 0 {
+		return ""
+	}
+
+	name := strings.TrimPrefix(ancestors[0].Name, "-")
+
+	for _, shell := range KNOWN_SHELLS {
+		if name == shell {
+			return name
+		}
+	}
+
+	return ""
+}
+
+/**
+ * Are we being recorded by script or asciinema?
+ */
+func isRecording() bool {
+	return len(os.Getenv("ASCIINEMA_REC")) > 0 || findAncestor("script", "asciinema") != nil
+}
+
+/**
+ * e.g. "↕3 fish nix direnv ●rec", only showing the parts that apply.
+ */
+func shellNesting() (string, string) {
+	plain := make([]string, 0)
+	colored := make([]string, 0)
+
+	add := func(str string, c *color.Color) {
+		plain = append(plain, str)
+		colored = append(colored, c.Sprint(str))
+	}
+
+	if level, err := strconv.Atoi(os.Getenv("SHLVL")); err == nil && level > shellLevelThreshold() {
+		add("↕"+strconv.Itoa(level), themeColor("shell-level", color.FgYellow))
+	}
+
+	// $SHELL is the login shell, even in shells started from it
+	if shell := currentShell(); len(shell) > 0 && shell != filepath.Base(os.Getenv("SHELL")) {
+		add(shell, themeColor("shell-name", color.FgHiYellow))
+	}
+
+	if nix := os.Getenv("IN_NIX_SHELL"); len(nix) > 0 {
+		str := "nix"
+		if nix == "pure" {
+			str += ":pure"
+		}
+
+		add(str, themeColor("shell-env", color.FgHiBlue))
+	}
+
+	if len(os.Getenv("DIRENV_DIR")) > 0 {
+		add("direnv", themeColor("shell-env", color.FgHiBlue))
+	}
+
+	if isRecording() {
+		add("●rec", themeColor("shell-recording", color.FgHiRed, color.Bold))
+	}
+
+	return strings.Join(plain, " "), strings.Join(colored, " ")
+}
@@ -0,0 +1,288 @@
+package main
+
+/**
+ * Powerline style: segments drawn as colored blocks, with separators computed from the
+ * backgrounds on either side.
+ */
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/fatih/color"
+)
+
+type PowerlineSymbols struct {
+	Left      string // Points right, between blocks on the left side
+	LeftThin  string // Same, but between blocks with the same background
+	Right     string // Points left, between blocks on the right side
+	RightThin string
+}
+
+var POWERLINE_SYMBOLS = map[string]PowerlineSymbols{
+	"nerd":  {"\ue0b0", "\ue0b1", "\ue0b2", "\ue0b3"},
+	"ascii": {">", "|", "<", "|"},
+}
+
+// Which of POWERLINE_SYMBOLS to use
+var POWERLINE_SEPARATORS = "nerd"
+
+// Block colors, overridden with "powerline-<segment name>" in the theme.  The segment's own
+// foreground colors are drawn on top, so these need to be dark enough for them to show up.
+var POWERLINE_DEFAULTS = map[string][]color.Attribute{
+	"user":       {48, 5, 238, color.FgHiWhite},
+	"workspace":  {48, 5, 30, color.FgHiWhite},
+	"dir":        {48, 5, 24, color.FgHiWhite},
+	"time":       {48, 5, 236, color.FgHiWhite},
+	"battery":    {48, 5, 238, color.FgHiWhite},
+	"login-cert": {48, 5, 52, color.FgHiWhite},
+	"exitcode":   {48, 5, 52, color.FgHiWhite},
+	"shell":      {48, 5, 58, color.FgHiWhite},
+	"kube":       {48, 5, 17, color.FgHiWhite},
+	"aws":        {48, 5, 94, color.FgHiWhite},
+	"docker":     {48, 5, 25, color.FgHiWhite},
+	"compose":    {48, 5, 25, color.FgHiWhite},
+	"cloud":      {48, 5, 53, color.FgHiWhite},
+	"python":     {48, 5, 22, color.FgHiWhite},
+	"vcs-branch": {48, 5, 236, color.FgHiWhite},
+	"vcs-files":  {48, 5, 238, color.FgHiWhite},
+	"prompt":     {48, 5, 236, color.FgHiWhite},
+}
+
+var POWERLINE_DEFAULT = []color.Attribute{48, 5, 237, color.FgHiWhite}
+
+func powerlineAttributes(name string) []color.Attribute {
+	defaults, ok := POWERLINE_DEFAULTS[name]
+	if !ok {
+		defaults = POWERLINE_DEFAULT
+	}
+
+	return themeAttributes("powerline-"+name, defaults...)
+}
+
+/**
+ * Splits attributes into the background color and everything else.
+ */
+func splitBackground(attrs []color.Attribute) (other []color.Attribute, background []color.Attribute) {
+	i := 0
+
+	for i < len(attrs) {
+		attr := attrs[i]
+		length := 1
+
+		if (attr == 38 || attr == 48) && i+1 < len(attrs) {
+			// Extended colors take their arguments with them
+			if attrs[i+1] == 2 {
+				length = 5
+			} else {
+				length = 3
+			}
+
+			if i+length > len(attrs) {
+				length = len(attrs) - i
+			}
+		}
+
+		if (attr >= 40 && attr <= 49) || (attr >= 100 && attr <= 107) {
+			background = append(background, attrs[i:i+length]...)
+		} else {
+			other = append(other, attrs[i:i+length]...)
+		}
+
+		i += length
+	}
+
+	return
+}
+
+/**
+ * Converts a background color into the same foreground color, for drawing separators.
+ */
+func backgroundAsForeground(background []color.Attribute) []color.Attribute {
+	foreground := make([]color.Attribute, len(background))
+	copy(foreground, background)
+
+	if len(foreground) > 0 {
+		// 40-49 -> 30-39, 100-107 -> 90-97, 48 -> 38
+		foreground[0] -= 10
+	}
+
+	return foreground
+}
+
+func sgr(attrs ...color.Attribute) string {
+	if color.NoColor || len(attrs) == 0 {
+		return ""
+	}
+
+	params := make([]string, len(attrs))
+	for i, attr := range attrs {
+		params[i] = fmt.Sprint(int(attr))
+	}
+
+	return "\x1B[" + strings.Join(params, ";") + "m"
+}
+
+func sameAttributes(a []color.Attribute, b []color.Attribute) bool {
+	return fmt.Sprint(a) == fmt.Sprint(b)
+}
+
+/**
+ * Groups visible segments into blocks: each segment starts a new one, unless it's joined to the previous.
+ */
+func powerlineBlocks(segments []*Segment) [][]*Segment {
+	blocks := make([][]*Segment, 0)
+
+	for _, s := range segments {
+		if s.Decoration || !s.Visible() {
+			continue
+		}
+
+		if s.Joined && len(blocks) > 0 {
+			blocks[len(blocks)-1] = append(blocks[len(blocks)-1], s)
+		} else {
+			blocks = append(blocks, []*Segment{s})
+		}
+	}
+
+	return blocks
+}
+
+/**
+ * Each block is padded with a space on each side and has one separator.
+ */
+func powerlineBlocksWidth(blocks [][]*Segment, separator string) int {
+	width := 0
+
+	for _, block := range blocks {
+		width += 2 + displayWidth(separator)
+
+		for _, s := range block {
+			width += displayWidth(s.Plain)
+		}
+	}
+
+	return width
+}
+
+func powerlineSymbols() PowerlineSymbols {
+	symbols, ok := POWERLINE_SYMBOLS[POWERLINE_SEPARATORS]
+	if !ok {
+		symbols = POWERLINE_SYMBOLS["nerd"]
+	}
+
+	return symbols
+}
+
+func powerlineWidth(l *Line) int {
+	symbols := powerlineSymbols()
+
+	// One space of fill, at minimum
+	return 1 + powerlineBlocksWidth(powerlineBlocks(l.Left), symbols.Left) +
+		powerlineBlocksWidth(powerlineBlocks(l.Right), symbols.Right)
+}
+
+/**
+ * Draws a block's segments on its background.  Segments bring their own colors, so the block colors
+ * are put back after every escape sequence (all of them after a reset, just the background otherwise).
+ */
+func renderPowerlineBlock(block []*Segment, attrs []color.Attribute) string {
+	_, background := splitBackground(attrs)
+
+	var content strings.Builder
+
+	for _, s := range block {
+		content.WriteString(ANSI_ESCAPE_REGEXP.ReplaceAllStringFunc(s.Colored, func(escape string) string {
+			matches := ANSI_ESCAPE_REGEXP.FindStringSubmatch(escape)
+
+			if matches[2] != "m" {
+				return escape
+			}
+
+			codes := parseSGRCodes(matches[1])
+			for _, code := range codes {
+				if code == 0 {
+					return escape + sgr(attrs...)
+				}
+			}
+
+			if len(codes) == 0 {
+				return escape + sgr(attrs...)
+			}
+
+			return escape + sgr(background...)
+		}))
+	}
+
+	return sgr(attrs...) + " " + content.String() + " "
+}
+
+/**
+ * Separator between two blocks.  The arrow is drawn in the color of the block it points out of.
+ */
+func powerlineSeparator(symbol string, thinSymbol string, from []color.Attribute, to []color.Attribute) string {
+	reset := sgr(color.Reset)
+
+	if len(from) > 0 && sameAttributes(from, to) {
+		// Same background on both sides, the arrow wouldn't show up
+		thinColor := themeAttributes("powerline-separator", color.FgHiBlack)
+		return reset + sgr(append(append([]color.Attribute{}, thinColor...), to...)...) + thinSymbol
+	}
+
+	return reset + sgr(append(backgroundAsForeground(from), to...)...) + symbol
+}
+
+func renderPowerline(l *Line, width int) string {
+	symbols := powerlineSymbols()
+
+	reset := sgr(color.Reset)
+
+	var out strings.Builder
+
+	// Left side: blocks point to the right, ending in an arrow onto the terminal background
+	var previous []color.Attribute
+
+	leftBlocks := powerlineBlocks(l.Left)
+
+	for i, block := range leftBlocks {
+		attrs := powerlineAttributes(block[0].Name)
+		_, background := splitBackground(attrs)
+
+		if i > 0 {
+			out.WriteString(powerlineSeparator(symbols.Left, symbols.LeftThin, previous, background))
+		}
+
+		out.WriteString(renderPowerlineBlock(block, attrs))
+		previous = background
+	}
+
+	if len(leftBlocks) > 0 {
+		out.WriteString(powerlineSeparator(symbols.Left, symbols.LeftThin, previous, nil))
+	}
+
+	out.WriteString(reset)
+
+	// Fill with the terminal background
+	fillRequired := width - powerlineWidth(l) + 1
+	if fillRequired < 1 {
+		fillRequired = 1
+	}
+
+	out.WriteString(strings.Repeat(" ", fillRequired))
+
+	// Right side: blocks point to the left, starting with an arrow off of the terminal background
+	previous = nil
+
+	for _, block := range powerlineBlocks(l.Right) {
+		attrs := powerlineAttributes(block[0].Name)
+		_, background := splitBackground(attrs)
+
+		out.WriteString(powerlineSeparator(symbols.Right, symbols.RightThin, background, previous))
+		out.WriteString(renderPowerlineBlock(block, attrs))
+		previous = background
+	}
+
+	out.WriteString(reset)
+
+	return out.String()
+}
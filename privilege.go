@@ -0,0 +1,87 @@
+package main
+
+/**
+ * Privilege: who we really are, who we're acting as, and whether we're in groups as good as root
+ */
+
+import (
+	"os"
+	"os/user"
+	"strconv"
+)
+
+type PrivilegeInfo struct {
+	// Who we're acting as (effective uid)
+	User string
+
+	// Who we really are (real uid), when it isn't User, e.g. in a setuid program's shell
+	RealUser string
+
+	// Who we were before sudo/su, empty if we haven't switched
+	OriginalUser string
+
+	// Privileged groups we're in
+	Groups []string
+}
+
+func lookupUsername(uid int) string {
+	if u, err := user.LookupId(strconv.Itoa(uid)); err == nil {
+		return u.Username
+	}
+
+	return strconv.Itoa(uid)
+}
+
+/**
+ * Groups the user is in that are listed in ~/.host/config/privileged_groups, one per line.  None
+ * by default, since most developer accounts are in sudo, wheel or docker.
+ */
+func privilegedGroups(u *user.User) []string {
+	wanted := readHostConfigLines("privileged_groups")
+	groups := make([]string, 0)
+
+	if len(wanted) == 0 {
+		return groups
+	}
+
+	ids, err := u.GroupIds()
+	if err != nil {
+		return groups
+	}
+
+	for _, id := range ids {
+		group, err := user.LookupGroupId(id)
+		if err != nil {
+			continue
+		}
+
+		for _, name := range wanted {
+			if group.Name == name {
+				groups = append(groups, name)
+			}
+		}
+	}
+
+	return groups
+}
+
+func NewPrivilegeInfo() *PrivilegeInfo {
+	info := &PrivilegeInfo{
+		User:         lookupUsername(os.Geteuid()),
+		OriginalUser: currentSession().OriginalUser,
+	}
+
+	if os.Getuid() != os.Geteuid() {
+		info.RealUser = lookupUsername(os.Getuid())
+	}
+
+	if info.OriginalUser == info.User {
+		info.OriginalUser = ""
+	}
+
+	if u, err := user.LookupId(strconv.Itoa(os.Geteuid())); err == nil {
+		info.Groups = privilegedGroups(u)
+	}
+
+	return info
+}
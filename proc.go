@@ -0,0 +1,119 @@
+package main
+
+/**
+ * Process information from /proc, mostly for walking up from the shell to see what it's running in
+ */
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strconv"
+	"strings"
+)
+
+type ProcessInfo struct {
+	Pid  int
+	PPid int
+	Name string
+
+	// Real user id
+	Uid int
+}
+
+/**
+ * Reads a process from /proc, or nil if it's gone (or this isn't Linux).
+ */
+func NewProcessInfo(pid int) *ProcessInfo {
+	stat, err := ioutil.ReadFile(fmt.Sprintf("/proc/%d/stat", pid))
+	if err != nil {
+		return nil
+	}
+
+	// The name is in parentheses and can contain anything, including spaces and parentheses
+	content := string(stat)
+	start := strings.Index(content, "(")
+	end := strings.LastIndex(content, ")")
+
+	if start < 0 || end < start {
+		return nil
+	}
+
+	fields := strings.Fields(content[end+1:])
+	if len(fields) < 2 {
+		return nil
+	}
+
+	ppid, err := strconv.Atoi(fields[1])
+	if err != nil {
+		return nil
+	}
+
+	info := &ProcessInfo{
+		Pid:  pid,
+		PPid: ppid,
+		Name: content[start+1 : end],
+		Uid:  -1,
+	}
+
+	status, err := ioutil.ReadFile(fmt.Sprintf("/proc/%d/status", pid))
+	if err == nil {
+		for _, line := range strings.Split(string(status), "\n") {
+			if strings.HasPrefix(line, "Uid:") {
+				uids := strings.Fields(strings.TrimPrefix(line, "Uid:"))
+				if len(uids) > 0 {
+					info.Uid, _ = strconv.Atoi(uids[0])
+				}
+				break
+			}
+		}
+	}
+
+	return info
+}
+
+// Loaded on first use
+var PROCESS_ANCESTORS []*ProcessInfo
+
+/**
+ * Our ancestors, starting with our parent (the shell) and ending just before init.
+ */
+func processAncestors() []*ProcessInfo {
+	if PROCESS_ANCESTORS != nil {
+		return PROCESS_ANCESTORS
+	}
+
+	ancestors := make([]*ProcessInfo, 0)
+
+	pid := os.Getppid()
+
+	// Bounded, in case of a loop from pids being reused mid-walk
+	for i := 0; i < 64 && pid > 1; i++ {
+		info := NewProcessInfo(pid)
+		if info == nil {
+			break
+		}
+
+		ancestors = append(ancestors, info)
+		pid = info.PPid
+	}
+
+	PROCESS_ANCESTORS = ancestors
+
+	return ancestors
+}
+
+/**
+ * The closest ancestor with one of these names, or nil.
+ */
+func findAncestor(names ...string) *ProcessInfo {
+	for _, ancestor := range processAncestors() {
+		for _, name := range names {
+			if ancestor.Name == name {
+				return ancestor
+			}
+		}
+	}
+
+	return nil
+}
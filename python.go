@@ -0,0 +1,131 @@
+package main
+
+/**
+ * Python environment: virtualenv, conda or pyenv, and the interpreter version, without running python
+ */
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/fatih/color"
+)
+
+type PythonInfo struct {
+	// Environment name, empty for a plain pyenv version
+	Name string
+
+	// Interpreter version, when we can tell
+	Version string
+}
+
+/**
+ * Reads the interpreter version from a virtualenv's pyvenv.cfg.  venv writes "version", virtualenv
+ * and uv write "version_info".
+ */
+func virtualenvVersion(venv string) string {
+	values := map[string]string{}
+
+	for _, line := range strings.Split(readTrimmed(filepath.Join(venv, "pyvenv.cfg")), "\n") {
+		parts := strings.SplitN(line, "=", 2)
+		if len(parts) == 2 {
+			values[strings.TrimSpace(parts[0])] = strings.TrimSpace(parts[1])
+		}
+	}
+
+	return firstNonEmpty(values["version"], values["version_info"])
+}
+
+/**
+ * A virtualenv's name.  Project-local ones are usually just ".venv", so use the project's name.
+ */
+func virtualenvName(venv string) string {
+	if prompt := os.Getenv("VIRTUAL_ENV_PROMPT"); len(prompt) > 0 {
+		// Older virtualenvs set this to the whole "(name) " prompt prefix
+		return strings.Trim(strings.TrimSpace(prompt), "()")
+	}
+
+	name := filepath.Base(venv)
+
+	switch name {
+	case ".venv", "venv", "env", ".env":
+		return filepath.Base(filepath.Dir(venv))
+	}
+
+	return name
+}
+
+/**
+ * Python's version in a conda environment, from the package metadata
+ * (conda-meta/python-3.11.5-h955ad1f_0.json).
+ */
+func condaVersion(prefix string) string {
+	matches, err := filepath.Glob(filepath.Join(prefix, "conda-meta", "python-[0-9]*.json"))
+	if err != nil || len(matches) == 0 {
+		return ""
+	}
+
+	parts := strings.Split(strings.TrimPrefix(filepath.Base(matches[0]), "python-"), "-")
+
+	return parts[0]
+}
+
+/**
+ * Loads the active environment, or nil if there isn't one.  pyenv's global version doesn't count,
+ * only one picked by PYENV_VERSION or a .python-version file.
+ */
+func NewPythonInfo() *PythonInfo {
+	if venv := os.Getenv("VIRTUAL_ENV"); len(venv) > 0 {
+		return &PythonInfo{Name: virtualenvName(venv), Version: virtualenvVersion(venv)}
+	}
+
+	// Conda's base environment is always active unless you turn that off, so it's not interesting
+	if env := os.Getenv("CONDA_DEFAULT_ENV"); len(env) > 0 && env != "base" {
+		return &PythonInfo{Name: filepath.Base(env), Version: condaVersion(os.Getenv("CONDA_PREFIX"))}
+	}
+
+	version := os.Getenv("PYENV_VERSION")
+
+	if len(version) == 0 {
+		if path := findUpwards(WORKING_DIRECTORY, ".python-version"); len(path) > 0 {
+			// Can list several versions, the first is the one "python" runs
+			fields := strings.Fields(readTrimmed(path))
+			if len(fields) == 0 {
+				return nil
+			}
+
+			version = fields[0]
+		}
+	}
+
+	if len(version) == 0 {
+		return nil
+	}
+
+	// pyenv-virtualenv environments look like versions
+	pyenvRoot := firstNonEmpty(os.Getenv("PYENV_ROOT"), filepath.Join(HOME, ".pyenv"))
+	venv := filepath.Join(pyenvRoot, "versions", version)
+
+	if fileExists(filepath.Join(venv, "pyvenv.cfg")) {
+		return &PythonInfo{Name: version, Version: virtualenvVersion(venv)}
+	}
+
+	return &PythonInfo{Version: version}
+}
+
+func pythonEnv() (string, string) {
+	info := NewPythonInfo()
+
+	if info == nil {
+		return "", ""
+	}
+
+	str := "py:" + info.Name
+	if len(info.Name) > 0 && len(info.Version) > 0 {
+		str += "/"
+	}
+	str += info.Version
+
+	return str, themeColor("python", color.FgHiGreen).Sprint(str)
+}
@@ -0,0 +1,125 @@
+package main
+
+/**
+ * What kind of session we're in: local or remote (ssh, mosh), and whether we got here through sudo/su
+ */
+
+import (
+	"os"
+	"os/user"
+	"strconv"
+	"strings"
+
+	"github.com/fatih/color"
+)
+
+type SessionInfo struct {
+	// "ssh", "mosh", or empty for a local session
+	Remote string
+
+	// Where the connection came from, when we know (mosh doesn't say)
+	ClientIP string
+
+	// Who we were before sudo -s/su, empty if we haven't switched
+	OriginalUser string
+
+	// SSH_AUTH_SOCK points back at the client's agent
+	AgentForwarded bool
+}
+
+/**
+ * The user that ran sudo/su to get this shell, or empty.  sudo tells us, for su we look at who
+ * started it.
+ */
+func originalUser() string {
+	if sudoUser := os.Getenv("SUDO_USER"); len(sudoUser) > 0 {
+		return sudoUser
+	}
+
+	for _, ancestor := range processAncestors() {
+		if ancestor.Name != "su" && ancestor.Name != "sudo" {
+			continue
+		}
+
+		parent := NewProcessInfo(ancestor.PPid)
+		if parent == nil || parent.Uid < 0 || parent.Uid == os.Getuid() {
+			return ""
+		}
+
+		if u, err := user.LookupId(strconv.Itoa(parent.Uid)); err == nil {
+			return u.Username
+		}
+
+		return strconv.Itoa(parent.Uid)
+	}
+
+	return ""
+}
+
+func NewSessionInfo() *SessionInfo {
+	info := &SessionInfo{}
+
+	// SSH_CONNECTION is "client_ip client_port server_ip server_port", SSH_CLIENT is the older
+	// "client_ip client_port server_port"
+	if connection := firstEnv("SSH_CONNECTION", "SSH_CLIENT"); len(connection) > 0 {
+		info.Remote = "ssh"
+		info.ClientIP = strings.Fields(connection)[0]
+	} else if len(os.Getenv("SSH_TTY")) > 0 {
+		info.Remote = "ssh"
+	}
+
+	// mosh-server doesn't pass on the SSH variables
+	if findAncestor("mosh-server") != nil {
+		info.Remote = "mosh"
+		info.ClientIP = ""
+	}
+
+	info.OriginalUser = originalUser()
+
+	// A forwarded agent is a socket sshd made for us, rather than one from an ssh-agent we started
+	// here (which sets SSH_AGENT_PID)
+	if len(info.Remote) > 0 && len(os.Getenv("SSH_AUTH_SOCK")) > 0 && len(os.Getenv("SSH_AGENT_PID")) == 0 {
+		info.AgentForwarded = true
+	}
+
+	return info
+}
+
+var SESSION *SessionInfo
+
+func currentSession() *SessionInfo {
+	if SESSION == nil {
+		SESSION = NewSessionInfo()
+	}
+
+	return SESSION
+}
+
+/**
+ * Where the session came from, when ~/.host/config/show_client_ip exists.
+ */
+func sessionClient() (string, string) {
+	session := currentSession()
+
+	if len(session.ClientIP) == 0 || !fileExists(hostConfigPath("show_client_ip")) {
+		return "", ""
+	}
+
+	str := "⇠" + session.ClientIP
+
+	return str, themeColor("session-client", color.FgHiBlack).Sprint(str)
+}
+
+/**
+ * Warns about a forwarded agent on hosts marked with ~/.host/config/shared_host, where anyone with
+ * root can use it to log in as us elsewhere.
+ */
+func agentForwarding() (string, string) {
+	if !currentSession().AgentForwarded || !fileExists(hostConfigPath("shared_host")) {
+		return "", ""
+	}
+
+	str := "!fwd"
+
+	return str, themeColor("agent-forwarded", color.FgHiRed, color.Bold).Sprint(str)
+}
@@ -0,0 +1,34 @@
+package main
+
+/**
+ * Output tweaks for the shell that's displaying the prompt
+ */
+
+import (
+	"strings"
+)
+
+// Which shell is going to display our output (zsh, bash, fish), or empty for plain output
+var SHELL_NAME string
+
+/**
+ * Marks escape sequences as zero-width so the shell can work out how long the prompt is.
+ *   zsh:   %{...%}, with literal % doubled
+ *   bash:  \001...\002, which readline understands even in command substitution output
+ *   other: left alone (fish measures escapes itself)
+ */
+func wrapForShell(str string) string {
+	switch SHELL_NAME {
+	case "zsh":
+		str = strings.Replace(str, "%", "%%", -1)
+		return ANSI_ESCAPE_REGEXP.ReplaceAllStringFunc(str, func(escape string) string {
+			return "%{" + escape + "%}"
+		})
+	case "bash":
+		return ANSI_ESCAPE_REGEXP.ReplaceAllStringFunc(str, func(escape string) string {
+			return "\x01" + escape + "\x02"
+		})
+	default:
+		return str
+	}
+}
@@ -0,0 +1,65 @@
+# Carapace prompt for fish.
+#
+#   source /path/to/carapaceprompt.fish
+#
+# Draws the full prompt with a right prompt, then collapses it to the one line transient prompt once
+# a command is accepted so scrollback isn't full of old prompts.
+#
+# NOTE: Rebinds Enter.
+
+function fish_prompt
+    set -l last_status $status
+
+    if set -q _carapace_transient
+        carapaceprompt -c --shell=fish --width=$COLUMNS --exitcode=$last_status --transient
+        return
+    end
+
+    set -l flags --shell=fish --width=$COLUMNS --exitcode=$last_status
+
+    # Job counts and names, from the State and Command columns at the end of each line
+    set -l running 0
+    set -l suspended 0
+    set -l jobnames
+    for line in (jobs 2>/dev/null | string match -rv '^Job\t')
+        set -l fields (string split \t -- $line)
+        set -l jobstate running
+        if test "$fields[-2]" = stopped
+            set jobstate suspended
+            set suspended (math $suspended + 1)
+        else
+            set running (math $running + 1)
+        end
+        set -a jobnames $jobstate:(string split -f1 ' ' -- $fields[-1])
+    end
+    set -a flags --jobs=$running,$suspended --jobnames=(string join , -- $jobnames)
+
+    carapaceprompt -c $flags --part=left
+end
+
+function fish_right_prompt
+    if set -q _carapace_transient
+        return
+    end
+
+    carapaceprompt -c --shell=fish --width=$COLUMNS --part=right
+end
+
+function _carapace_execute
+    set -l cmd (commandline)
+
+    # Only collapse when a command is actually going to run
+    if test -n "$cmd"; and commandline --is-valid
+        set -g _carapace_transient 1
+        commandline -f repaint
+    end
+
+    commandline -f execute
+end
+
+function _carapace_postexec --on-event fish_postexec
+    set -e _carapace_transient
+end
+
+bind \r _carapace_execute
+bind \n _carapace_execute
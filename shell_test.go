@@ -0,0 +1,95 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+/**
+ * Checks that every escape is inside exactly one start/end pair, and nothing else is.
+ */
+func checkWrapped(t *testing.T, name string, wrapped string, start string, end string) {
+	rest := wrapped
+
+	for {
+		open := strings.Index(rest, start)
+		if open < 0 {
+			break
+		}
+
+		if strings.Contains(rest[:open], "\x1b") || strings.Contains(rest[:open], end) {
+			t.Errorf("%v: unwrapped escape or stray end marker in %q", name, wrapped)
+		}
+
+		rest = rest[open+len(start):]
+
+		close := strings.Index(rest, end)
+		if close < 0 {
+			t.Errorf("%v: unterminated start marker in %q", name, wrapped)
+			return
+		}
+
+		if inner := rest[:close]; !ANSI_ESCAPE_REGEXP.MatchString(inner) || ANSI_ESCAPE_REGEXP.FindString(inner) != inner {
+			t.Errorf("%v: wrapped %q isn't a single escape", name, inner)
+		}
+
+		rest = rest[close+len(end):]
+	}
+
+	if strings.Contains(rest, "\x1b") || strings.Contains(rest, end) {
+		t.Errorf("%v: unwrapped escape or stray end marker in %q", name, wrapped)
+	}
+}
+
+func TestWrapForShell(t *testing.T) {
+	defer func(name string) { SHELL_NAME = name }(SHELL_NAME)
+
+	inputs := map[string]string{
+		"plain":          "no escapes",
+		"single color":   "\x1b[31mred\x1b[0m",
+		"reset at end":   "\x1b[1;32m~/src\x1b[0m \x1b[33m(main)\x1b[0m",
+		"adjacent":       "\x1b[1m\x1b[38;5;238m\x1b[48;5;21mpowerline\x1b[m",
+		"percent":        "\x1b[33m100%\x1b[0m",
+		"empty reset":    "\x1b[m",
+		"other escapes":  "\x1b[2Kcleared\x1b[32mgreen\x1b[0m",
+		"only text tail": "\x1b[31mred\x1b[0m and then some",
+	}
+
+	shells := []struct {
+		shell string
+		start string
+		end   string
+	}{
+		{"zsh", "%{", "%}"},
+		{"bash", "\x01", "\x02"},
+	}
+
+	for _, shell := range shells {
+		SHELL_NAME = shell.shell
+
+		for name, input := range inputs {
+			wrapped := wrapForShell(input)
+			checkWrapped(t, shell.shell+" "+name, wrapped, shell.start, shell.end)
+
+			if escapes := len(ANSI_ESCAPE_REGEXP.FindAllString(input, -1)); strings.Count(wrapped, shell.start) != escapes {
+				t.Errorf("%v %v: got %d start markers for %d escapes in %q", shell.shell, name,
+					strings.Count(wrapped, shell.start), escapes, wrapped)
+			}
+		}
+	}
+
+	SHELL_NAME = "zsh"
+	if actual, expected := wrapForShell("\x1b[33m100%\x1b[0m"), "%{\x1b[33m%}100%%%{\x1b[0m%}"; actual != expected {
+		t.Errorf("zsh: got %q, expected %q", actual, expected)
+	}
+
+	SHELL_NAME = "bash"
+	if actual, expected := wrapForShell("\x1b[33m100%\x1b[0m"), "\x01\x1b[33m\x02100%\x01\x1b[0m\x02"; actual != expected {
+		t.Errorf("bash: got %q, expected %q", actual, expected)
+	}
+
+	SHELL_NAME = "fish"
+	if actual, expected := wrapForShell("\x1b[33m100%\x1b[0m"), "\x1b[33m100%\x1b[0m"; actual != expected {
+		t.Errorf("fish: got %q, expected %q", actual, expected)
+	}
+}
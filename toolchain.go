@@ -0,0 +1,150 @@
+package main
+
+/**
+ * Language toolchain versions, shown when the directory is in a project that uses them.  Versions
+ * come from the project's files, the toolchains themselves are never run.
+ */
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/fatih/color"
+)
+
+type Toolchain struct {
+	Name string
+
+	// Files that mark a project, looked for in the directory and its parents.  Earlier markers win
+	// when there's more than one in the same directory.
+	Markers []string
+
+	// Reads the version from the marker that was found, empty if it doesn't say
+	Version func(marker string) string
+
+	Color []color.Attribute
+}
+
+/**
+ * The first group of the first match of a pattern in a file, or empty.
+ */
+func matchInFile(path string, pattern *regexp.Regexp) string {
+	content, err := ioutil.ReadFile(path)
+	if err != nil {
+		return ""
+	}
+
+	match := pattern.FindSubmatch(content)
+	if match == nil {
+		return ""
+	}
+
+	return strings.TrimSpace(string(match[1]))
+}
+
+/**
+ * Version files that just contain the version (.nvmrc, .ruby-version, ...).
+ */
+func versionFile(path string) string {
+	return strings.TrimSpace(strings.SplitN(readTrimmed(path), "\n", 2)[0])
+}
+
+// Where the toolchains keep their versions in project files
+var (
+	GO_VERSION_REGEXP          = regexp.MustCompile(`(?m)^go\s+(\S+)`)
+	NODE_ENGINE_REGEXP         = regexp.MustCompile(`"engines"\s*:\s*\{[^}]*"node"\s*:\s*"([^"]*)"`)
+	RUST_VERSION_REGEXP        = regexp.MustCompile(`(?m)^rust-version\s*=\s*"([^"]*)"`)
+	RUST_CHANNEL_REGEXP        = regexp.MustCompile(`(?m)^channel\s*=\s*"([^"]*)"`)
+	MAVEN_JAVA_VERSION_REGEXP  = regexp.MustCompile(`<(?:maven\.compiler\.release|maven\.compiler\.source|java\.version)>([^<]*)<`)
+	GRADLE_JAVA_VERSION_REGEXP = regexp.MustCompile(`(?:sourceCompatibility\s*=\s*['"]?|JavaVersion\.VERSION_|JavaLanguageVersion\.of\()([0-9][0-9_.]*)`)
+	GEMFILE_RUBY_REGEXP        = regexp.MustCompile(`(?m)^ruby\s+['"]([^'"]*)['"]`)
+)
+
+var TOOLCHAINS = []Toolchain{
+	{
+		Name:    "go",
+		Markers: []string{"go.work", "go.mod"},
+		Version: func(marker string) string {
+			return matchInFile(marker, GO_VERSION_REGEXP)
+		},
+		Color: []color.Attribute{color.FgCyan},
+	},
+	{
+		Name:    "node",
+		Markers: []string{".nvmrc", ".node-version", "package.json"},
+		Version: func(marker string) string {
+			if filepath.Base(marker) == "package.json" {
+				return matchInFile(marker, NODE_ENGINE_REGEXP)
+			}
+
+			return versionFile(marker)
+		},
+		Color: []color.Attribute{color.FgGreen},
+	},
+	{
+		Name:    "rust",
+		Markers: []string{"rust-toolchain.toml", "rust-toolchain", "Cargo.toml"},
+		Version: func(marker string) string {
+			switch filepath.Base(marker) {
+			case "Cargo.toml":
+				return matchInFile(marker, RUST_VERSION_REGEXP)
+			case "rust-toolchain":
+				// Either just the channel, or the same TOML as rust-toolchain.toml
+				if !strings.Contains(readTrimmed(marker), "[toolchain]") {
+					return versionFile(marker)
+				}
+			}
+
+			return matchInFile(marker, RUST_CHANNEL_REGEXP)
+		},
+		Color: []color.Attribute{color.FgRed},
+	},
+	{
+		Name:    "java",
+		Markers: []string{".java-version", "pom.xml", "build.gradle.kts", "build.gradle"},
+		Version: func(marker string) string {
+			switch filepath.Base(marker) {
+			case ".java-version":
+				return versionFile(marker)
+			case "pom.xml":
+				return matchInFile(marker, MAVEN_JAVA_VERSION_REGEXP)
+			}
+
+			// sourceCompatibility = '17', JavaVersion.VERSION_17, or a toolchain's JavaLanguageVersion.of(17)
+			return matchInFile(marker, GRADLE_JAVA_VERSION_REGEXP)
+		},
+		Color: []color.Attribute{color.FgYellow},
+	},
+	{
+		Name:    "ruby",
+		Markers: []string{".ruby-version", "Gemfile"},
+		Version: func(marker string) string {
+			if filepath.Base(marker) == "Gemfile" {
+				return matchInFile(marker, GEMFILE_RUBY_REGEXP)
+			}
+
+			return versionFile(marker)
+		},
+		Color: []color.Attribute{color.FgHiRed},
+	},
+}
+
+/**
+ * Segment text for a toolchain, e.g. "go:1.21", or just "go" if the project doesn't pin a version.
+ */
+func toolchainVersion(toolchain Toolchain) (string, string) {
+	marker := findUpwards(WORKING_DIRECTORY, toolchain.Markers...)
+
+	if len(marker) == 0 {
+		return "", ""
+	}
+
+	str := toolchain.Name
+	if version := toolchain.Version(marker); len(version) > 0 {
+		str += ":" + version
+	}
+
+	return str, themeColor("toolchain-"+toolchain.Name, toolchain.Color...).Sprint(str)
+}
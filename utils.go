@@ -7,14 +7,15 @@ package main
 import (
 	"bytes"
 	"fmt"
+	"io/ioutil"
 	"log"
 	"os/exec"
 	"path/filepath"
 	"regexp"
 	"strconv"
 	"strings"
+	"sync"
 	"syscall"
-	"unicode/utf8"
 
 	"os"
 )
@@ -32,9 +33,9 @@ import (
  * fillChar:    What character to use as the filler.
  */
 func fitAStringToWidth(width int, left string, right string, fillChar string) string {
-	leftLen := utf8.RuneCountInString(left)
-	rightLen := utf8.RuneCountInString(right)
-	fillCharLen := utf8.RuneCountInString(fillChar) // Usually 1
+	leftLen := displayWidth(left)
+	rightLen := displayWidth(right)
+	fillCharLen := displayWidth(fillChar) // Usually 1
 
 	// Figure out how many filler chars we need
 	fillLen := width - (leftLen + rightLen)
@@ -51,7 +52,7 @@ func fitAStringToWidth(width int, left string, right string, fillChar string) st
 
 func rightJustify(width int, str string) string {
 
-	rightJustfyLen := width - utf8.RuneCountInString(str)
+	rightJustfyLen := width - displayWidth(str)
 
 	var rightJustify = ""
 	if rightJustfyLen > 0 {
@@ -62,7 +63,7 @@ func rightJustify(width int, str string) string {
 }
 
 func centerString(width int, str string) string {
-	start := (width / 2) - (utf8.RuneCountInString(str) / 2)
+	start := (width / 2) - (displayWidth(str) / 2)
 
 	if start > 0 {
 		return fmt.Sprintf("%s%s", strings.Repeat(" ", start), str)
@@ -72,16 +73,15 @@ func centerString(width int, str string) string {
 }
 
 func truncateAndEllipsisAtStart(str string, maxLength int) string {
-	if len(str) > maxLength {
-		charsToSkip := len(str) - (maxLength - 1)
-		newStr := "…" + str[charsToSkip:]
+	if displayWidth(str) > maxLength {
+		newStr := "…" + trimStartToWidth(str, maxLength-displayWidth("…"))
 		return newStr
 	}
 
 	return str
 }
 
-var ANSI_REGEXP = regexp.MustCompile(`\x1B\[(([0-9]{1,2})?(;)?([0-9]{1,2})?)?[m,K,H,f,J]`)
+var ANSI_REGEXP = regexp.MustCompile(`\x1B\[[0-9;?]*[A-Za-z]`)
 
 func stripANSI(str string) string {
 	return ANSI_REGEXP.ReplaceAllLiteralString(str, "")
@@ -200,6 +200,68 @@ func normalizePath(osPathname string) string {
 	}
 }
 
+/**
+ * Expands a leading "~/" to the home directory.
+ */
+func expandHome(path string) string {
+	if path == "~" {
+		return HOME
+	} else if strings.HasPrefix(path, "~/") {
+		return filepath.Join(HOME, path[2:])
+	} else {
+		return path
+	}
+}
+
+func firstNonEmpty(values ...string) string {
+	for _, value := range values {
+		if len(value) > 0 {
+			return value
+		}
+	}
+
+	return ""
+}
+
+/**
+ * A small file's contents without surrounding whitespace, or empty if it can't be read.
+ */
+func readTrimmed(path string) string {
+	content, err := ioutil.ReadFile(path)
+	if err != nil {
+		return ""
+	}
+
+	return strings.TrimSpace(string(content))
+}
+
+/**
+ * Looks for any of the names in dir and then each of its parents, returning the first path found
+ * (or empty).  Names are checked in order within each directory.
+ */
+func findUpwards(dir string, names ...string) string {
+	if len(dir) == 0 {
+		return ""
+	}
+
+	for {
+		for _, name := range names {
+			path := filepath.Join(dir, name)
+
+			if fileExists(path) {
+				return path
+			}
+		}
+
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return ""
+		}
+
+		dir = parent
+	}
+}
+
 func fileExists(path string) bool {
 	_, err := os.Stat(path)
 
@@ -210,6 +272,136 @@ func fileExists(path string) bool {
 	}
 }
 
+////////////////////////////////////////////
+// Utility: File Formats
+////////////////////////////////////////////
+
+/**
+ * Reads an INI style file (AWS, gcloud, ...) into section -> key -> value.  Keys outside of any
+ * section go in "".  Returns nil if the file can't be read.
+ */
+func readINIFile(path string) map[string]map[string]string {
+	content, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil
+	}
+
+	sections := map[string]map[string]string{"": {}}
+	section := ""
+
+	for _, line := range strings.Split(string(content), "\n") {
+		line = strings.TrimSpace(line)
+
+		if len(line) <= 0 || strings.HasPrefix(line, "#") || strings.HasPrefix(line, ";") {
+			continue
+		}
+
+		if strings.HasPrefix(line, "[") && strings.HasSuffix(line, "]") {
+			section = strings.TrimSpace(line[1 : len(line)-1])
+			if _, ok := sections[section]; !ok {
+				sections[section] = map[string]string{}
+			}
+			continue
+		}
+
+		parts := strings.SplitN(line, "=", 2)
+		if len(parts) == 2 {
+			sections[section][strings.TrimSpace(parts[0])] = strings.TrimSpace(parts[1])
+		}
+	}
+
+	return sections
+}
+
+////////////////////////////////////////////
+// Utility: Host Config
+////////////////////////////////////////////
+
+/**
+ * Path to a file in the per-host config directory (~/.host/config).
+ */
+func hostConfigPath(name string) string {
+	return filepath.Join(HOME, ".host/config", name)
+}
+
+/**
+ * Reads a per-host config file, returning the non-empty lines that aren't comments.
+ * Missing files are treated as empty.
+ */
+func readHostConfigLines(name string) []string {
+	lines := make([]string, 0)
+
+	content, err := ioutil.ReadFile(hostConfigPath(name))
+	if err != nil {
+		return lines
+	}
+
+	for _, line := range strings.Split(string(content), "\n") {
+		line = strings.TrimSpace(line)
+
+		if len(line) <= 0 || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		lines = append(lines, line)
+	}
+
+	return lines
+}
+
+/**
+ * Reads a per-host config file of "key = value" lines, in file order.
+ */
+func readHostConfigPairs(name string) [][2]string {
+	pairs := make([][2]string, 0)
+
+	for _, line := range readHostConfigLines(name) {
+		parts := strings.SplitN(line, "=", 2)
+
+		if len(parts) != 2 {
+			log.Printf("Ignoring malformed line in %v: %v", name, line)
+			continue
+		}
+
+		pairs = append(pairs, [2]string{strings.TrimSpace(parts[0]), strings.TrimSpace(parts[1])})
+	}
+
+	return pairs
+}
+
+var DEFAULT_PRODUCTION_PATTERNS = []string{`(?i)prod`}
+
+var PRODUCTION_PATTERNS []*regexp.Regexp
+var PRODUCTION_PATTERNS_ONCE sync.Once
+
+/**
+ * Does the name (cluster, account, workspace, ...) look like production?  Patterns are regular
+ * expressions from ~/.host/config/production_patterns, one per line, loaded the first time we need
+ * them.  Patterns that don't compile are skipped.
+ */
+func isProduction(name string) bool {
+	PRODUCTION_PATTERNS_ONCE.Do(func() {
+		patterns := readHostConfigLines("production_patterns")
+		if len(patterns) == 0 {
+			patterns = DEFAULT_PRODUCTION_PATTERNS
+		}
+
+		for _, pattern := range patterns {
+			if re, err := regexp.Compile(pattern); err == nil {
+				PRODUCTION_PATTERNS = append(PRODUCTION_PATTERNS, re)
+			}
+		}
+	})
+
+	for _, re := range PRODUCTION_PATTERNS {
+		if re.MatchString(name) {
+			return true
+		}
+	}
+
+	return false
+}
+
 ////////////////////////////////////////////
 // Utility: 8-bit ANSI Colors
 ////////////////////////////////////////////
@@ -219,42 +411,24 @@ func fileExists(path string) bool {
  * https://en.wikipedia.org/wiki/ANSI_escape_code#8-bit
  */
 func Color8BitAsString(index int) string {
-	retval := "fg-black"
+	color4Bit := color8BitTo4Bit(index)
+
+	if color4Bit < 8 {
+		return "fg-" + ANSI_COLOR_NAMES[color4Bit]
+	} else {
+		return "fg-" + ANSI_COLOR_NAMES[color4Bit-8] + ",fg-bold"
+	}
+}
+
+/**
+ * Converts an 8-bit color index into a 3/4-bit color index (0-15, where 8+ are the bright colors).
+ */
+func color8BitTo4Bit(index int) int {
+	retval := 0
 
 	if index < 16 {
-		switch index {
-		case 0:
-			retval = "fg-black"
-		case 1:
-			retval = "fg-red"
-		case 2:
-			retval = "fg-green"
-		case 3:
-			retval = "fg-yellow"
-		case 4:
-			retval = "fg-blue"
-		case 5:
-			retval = "fg-magenta"
-		case 6:
-			retval = "fg-cyan"
-		case 7:
-			retval = "fg-white"
-		case 8:
-			retval = "fg-black,fg-bold"
-		case 9:
-			retval = "fg-red,fg-bold"
-		case 10:
-			retval = "fg-green,fg-bold"
-		case 11:
-			retval = "fg-yellow,fg-bold"
-		case 12:
-			retval = "fg-blue,fg-bold"
-		case 13:
-			retval = "fg-magenta,fg-bold"
-		case 14:
-			retval = "fg-cyan,fg-bold"
-		case 15:
-			retval = "fg-white,fg-bold"
+		if index >= 0 {
+			retval = index
 		}
 	} else if index < 232 {
 		// Palletized colors
@@ -265,97 +439,232 @@ func Color8BitAsString(index int) string {
 		i -= g * 6
 		b := i
 
-		smallColor := "fg-black"
+		// Each channel is either on or off, and anything on is bright
+		smallColor := 0
 
 		if r >= 3 {
-			// Red on
-			if g >= 3 {
-				// Green on
-				if b >= 3 {
-					// Blue on
-					smallColor = "fg-white,fg-bold"
-				} else {
-					// Blue off
-					smallColor = "fg-yellow,fg-bold"
-				}
-			} else {
-				// Green off
-				if b >= 3 {
-					// Blue on
-					smallColor = "fg-magenta,fg-bold"
-				} else {
-					// Blue off
-					smallColor = "fg-red,fg-bold"
-				}
-			}
-		} else {
-			// Red off
-			if g >= 3 {
-				// Green on
-				if b >= 3 {
-					// Blue on
-					smallColor = "fg-cyan,fg-bold"
-				} else {
-					// Blue off
-					smallColor = "fg-green,fg-bold"
-				}
-			} else {
-				// Green off
-				if b >= 3 {
-					// Blue on
-					smallColor = "fg-blue,fg-bold"
-				} else {
-					// Blue off
-					smallColor = "fg-black"
-				}
-			}
+			smallColor |= 1
+		}
+		if g >= 3 {
+			smallColor |= 2
+		}
+		if b >= 3 {
+			smallColor |= 4
+		}
+
+		if smallColor != 0 {
+			smallColor += 8
 		}
 
 		retval = smallColor
 	} else {
-		// Grayscale colors
+		// Grayscale colors, darkest to lightest: black, bright black (dark gray), white (light
+		// gray), bright white
 		if index < 238 {
-			retval = "fg-black"
+			retval = 0
 		} else if index < 244 {
-			retval = "fg-white"
+			retval = 8
 		} else if index < 250 {
-			retval = "fg-black,fg-bold"
-		} else if index < 256 {
-			retval = "fg-white,fg-bold"
+			retval = 7
+		} else {
+			retval = 15
 		}
 	}
 
 	return retval
+}
+
+/**
+ * Finds the closest entry in the 256-color palette for a 24-bit color.
+ * Considers both the 6x6x6 color cube and the grayscale ramp.
+ */
+func rgbTo8BitIndex(r int, g int, b int) int {
+	cubeLevels := []int{0, 95, 135, 175, 215, 255}
+
+	toCube := func(v int) int {
+		if v < 48 {
+			return 0
+		} else if v < 115 {
+			return 1
+		} else {
+			return (v - 35) / 40
+		}
+	}
 
+	distance := func(r2 int, g2 int, b2 int) int {
+		return (r-r2)*(r-r2) + (g-g2)*(g-g2) + (b-b2)*(b-b2)
+	}
+
+	// Closest color cube entry
+	ri, gi, bi := toCube(r), toCube(g), toCube(b)
+	cubeIndex := 16 + (36 * ri) + (6 * gi) + bi
+	cubeDistance := distance(cubeLevels[ri], cubeLevels[gi], cubeLevels[bi])
+
+	// Closest grayscale entry
+	grayIndex := ((r+g+b)/3 - 3) / 10
+	if grayIndex < 0 {
+		grayIndex = 0
+	} else if grayIndex > 23 {
+		grayIndex = 23
+	}
+	grayLevel := 8 + (10 * grayIndex)
+	grayDistance := distance(grayLevel, grayLevel, grayLevel)
+
+	if grayDistance < cubeDistance {
+		return 232 + grayIndex
+	} else {
+		return cubeIndex
+	}
 }
 
 //////////////////////////////////////////////
 // Utility: Convert ANSI to (fg-color) syntax
 //////////////////////////////////////////////
 
-// TODO: Regexp doesn't support multiple starts before a reset
-// Ex ".[38;5;226m_ /"".[38;5;250m.-.    .[0m"
-//var ANSI_COLOR_GROUPING_REGEXP = regexp.MustCompile(`\x1B\x5B(?P<sgr>(?:[0-9]+;?)+)m(?P<content>[^\x1B]+)\x1B\x5B0?m`)
-var ANSI_COLOR_GROUPING_REGEXP = regexp.MustCompile(`\x1B\x5B(?P<sgr>(?:[0-9]+;?)+)m(?P<content>[^\x1B]+)`)
-
-var ANSI_COLOR_MAPPINGS = map[int]string{
-	1:  "fg-bold",
-	30: "fg-black",
-	31: "fg-red",
-	32: "fg-green",
-	33: "fg-yellow",
-	34: "fg-blue",
-	35: "fg-magenta",
-	36: "fg-cyan",
-	37: "fg-white",
-	40: "fg-black",
-	41: "fg-red",
-	42: "fg-green",
-	43: "fg-yellow",
-	44: "fg-blue",
-	45: "fg-magenta",
-	46: "fg-cyan",
-	47: "fg-white",
+var ANSI_ESCAPE_REGEXP = regexp.MustCompile(`\x1B\[([0-9;]*)([A-Za-z])`)
+
+var ANSI_COLOR_NAMES = []string{
+	"black",
+	"red",
+	"green",
+	"yellow",
+	"blue",
+	"magenta",
+	"cyan",
+	"white",
+}
+
+/**
+ * Graphic rendition state, built up by applying SGR sequences in order.
+ */
+type SGRState struct {
+	Foreground string
+	Background string
+	Bold       bool
+	Italic     bool
+	Underline  bool
+}
+
+func (s *SGRState) Reset() {
+	*s = SGRState{}
+}
+
+func (s *SGRState) IsEmpty() bool {
+	return *s == SGRState{}
+}
+
+func (s *SGRState) Apply(codes []int) {
+	if len(codes) == 0 {
+		// "ESC[m" is the same as "ESC[0m"
+		s.Reset()
+		return
+	}
+
+	i := 0
+
+	for i < len(codes) {
+		code := codes[i]
+
+		switch {
+		case code == 0:
+			s.Reset()
+		case code == 1:
+			s.Bold = true
+		case code == 3:
+			s.Italic = true
+		case code == 4:
+			s.Underline = true
+		case code == 21 || code == 22:
+			s.Bold = false
+		case code == 23:
+			s.Italic = false
+		case code == 24:
+			s.Underline = false
+		case code >= 30 && code <= 37:
+			s.Foreground = "fg-" + ANSI_COLOR_NAMES[code-30]
+		case code == 38:
+			// Foreground palette or RGB
+			consumed, color := SGR256ColorToString(codes[i+1:])
+			i += consumed
+			s.Foreground = color
+		case code == 39:
+			s.Foreground = ""
+		case code >= 40 && code <= 47:
+			s.Background = "bg-" + ANSI_COLOR_NAMES[code-40]
+		case code == 48:
+			// Background palette or RGB
+			consumed, color := SGR256ColorToString(codes[i+1:])
+			i += consumed
+			s.Background = strings.Replace(color, "fg", "bg", -1)
+		case code == 49:
+			s.Background = ""
+		case code >= 90 && code <= 97:
+			// Bright foreground
+			s.Foreground = "fg-" + ANSI_COLOR_NAMES[code-90] + ",fg-bold"
+		case code >= 100 && code <= 107:
+			// Bright background
+			s.Background = "bg-" + ANSI_COLOR_NAMES[code-100] + ",bg-bold"
+		}
+
+		i++
+	}
+}
+
+// Renders the state as a (fg-color) attribute list, empty when nothing is set
+func (s *SGRState) String() string {
+	attrs := make([]string, 0)
+
+	appendAttrs := func(str string) {
+		for _, attr := range strings.Split(str, ",") {
+			if len(attr) == 0 {
+				continue
+			}
+
+			found := false
+			for _, existing := range attrs {
+				if existing == attr {
+					found = true
+					break
+				}
+			}
+
+			if !found {
+				attrs = append(attrs, attr)
+			}
+		}
+	}
+
+	appendAttrs(s.Foreground)
+
+	if s.Bold {
+		appendAttrs("fg-bold")
+	}
+	if s.Underline {
+		appendAttrs("fg-underline")
+	}
+	if s.Italic {
+		appendAttrs("fg-italic")
+	}
+
+	appendAttrs(s.Background)
+
+	return strings.Join(attrs, ",")
+}
+
+func parseSGRCodes(sgr string) []int {
+	codes := make([]int, 0)
+
+	if len(sgr) == 0 {
+		return codes
+	}
+
+	for _, x := range strings.Split(sgr, ";") {
+		// Empty parameters are treated as zero
+		code, _ := strconv.Atoi(x)
+		codes = append(codes, code)
+	}
+
+	return codes
 }
 
 func palletizedColorToString(index int) string {
@@ -363,29 +672,28 @@ func palletizedColorToString(index int) string {
 }
 
 func rgbColorToString(r int, g int, b int) string {
-	log.Printf("We don't know how to handle RGB color yet.  Color: #%02x%02x%02x)", r, g, b)
-	return "fg-white"
+	return Color8BitAsString(rgbTo8BitIndex(r, g, b))
 }
 
 // Returns how many elements were consumed and the color string
 func SGR256ColorToString(parts []int) (int, string) {
 	if len(parts) < 1 {
 		log.Printf("Error parsing 256-color SGR code (bad length).  Length: %d, Parts: %v", len(parts), parts)
-		return 1, "fg-white"
+		return 0, "fg-white"
 	}
 
 	switch parts[0] {
 	case 2:
 		if len(parts) < 4 {
 			log.Printf("Error parsing 256-color SGR code (not enough numbers for RGB).  Parts: %v", parts)
-			return 1, "fg-white"
+			return len(parts), "fg-white"
 		} else {
 			return 4, rgbColorToString(parts[1], parts[2], parts[3])
 		}
 	case 5:
 		if len(parts) < 2 {
 			log.Printf("Error parsing 256-color SGR code (no index for palette).  Parts: %v", parts)
-			return 1, "fg-white"
+			return len(parts), "fg-white"
 		} else {
 			return 2, palletizedColorToString(parts[1])
 		}
@@ -396,76 +704,48 @@ func SGR256ColorToString(parts []int) (int, string) {
 }
 
 func SGRToColorString(sgr string) string {
-	parts := strings.Split(sgr, ";")
-	iparts := make([]int, len(parts))
+	var state SGRState
+	state.Apply(parseSGRCodes(sgr))
+	return state.String()
+}
 
-	for i, x := range parts {
-		iparts[i], _ = strconv.Atoi(x)
-	}
+/**
+ * Converts text with ANSI escapes into termui's "[text](fg-color)" syntax.
+ *
+ * SGR sequences are applied in order to a running state, so attributes accumulate until they're
+ * cleared or reset.  Any other escape sequences are dropped.
+ */
+func ConvertANSIToColorStrings(ansi string) string {
+	var state SGRState
+	var retval strings.Builder
 
-	i := 0
-	retval := ""
+	appendContent := func(content string) {
+		if len(content) <= 0 {
+			return
+		}
 
-	appendRet := func(str string) {
-		if len(retval) > 0 {
-			retval += "," + str
+		if state.IsEmpty() {
+			retval.WriteString(content)
 		} else {
-			retval += str
+			fmt.Fprintf(&retval, "[%v](%v)", content, state.String())
 		}
 	}
 
-	for i < len(iparts) {
-		if val, ok := ANSI_COLOR_MAPPINGS[iparts[i]]; ok {
-			// if it's in the map, use that
-			appendRet(val)
-		} else {
-			switch iparts[i] {
-			case 38:
-				// Foreground palette or RGB
-				relevantSlice := iparts[i+1:]
-				consumed, color := SGR256ColorToString(relevantSlice)
-
-				i += consumed
-				appendRet(color)
-
-			case 48:
-				// Background palette or RGB
-				relevantSlice := iparts[i+1:]
-				consumed, color := SGR256ColorToString(relevantSlice)
-
-				color = strings.Replace(color, "fg", "bg", -1)
+	last := 0
 
-				i += consumed
-				appendRet(color)
+	for _, match := range ANSI_ESCAPE_REGEXP.FindAllStringSubmatchIndex(ansi, -1) {
+		// Everything before this escape uses the current state
+		appendContent(ansi[last:match[0]])
 
-			}
+		// Only SGR ("m") sequences change the colors
+		if ansi[match[4]:match[5]] == "m" {
+			state.Apply(parseSGRCodes(ansi[match[2]:match[3]]))
 		}
 
-		i++
+		last = match[1]
 	}
 
-	return retval
-}
-
-func ConvertANSIToColorStrings(ansi string) string {
-	retval := ANSI_COLOR_GROUPING_REGEXP.ReplaceAllStringFunc(ansi, func(matchStr string) string {
-		// matchStr should be the regexp, let's match it again to get the groupings
-		matches := ANSI_COLOR_GROUPING_REGEXP.FindStringSubmatch(matchStr)
-
-		// 0 is the whole string, 1+ are match groups
-		sgr := matches[1]
-		content := matches[2]
-
-		colorStr := SGRToColorString(sgr)
-
-		if len(colorStr) <= 0 {
-			// No change
-			return content
-		} else {
-			coloredContent := fmt.Sprintf("[%v](%v)", content, colorStr)
-			return coloredContent
-		}
-	})
+	appendContent(ansi[last:])
 
-	return stripANSI(retval)
+	return retval.String()
 }
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"testing"
+)
+
+func TestConvertANSIToColorStrings(t *testing.T) {
+	tests := []struct {
+		name     string
+		ansi     string
+		expected string
+	}{
+		{"plain", "no escapes", "no escapes"},
+		{"single color", "\x1b[31mred\x1b[0m", "[red](fg-red)"},
+		{"reset", "\x1b[31mred\x1b[0m plain", "[red](fg-red) plain"},
+		{"empty reset", "\x1b[31mred\x1b[m plain", "[red](fg-red) plain"},
+		{"stacked attributes", "\x1b[1m\x1b[32mbold green\x1b[0m", "[bold green](fg-green,fg-bold)"},
+		{"combined codes", "\x1b[1;4;32mboth\x1b[0m", "[both](fg-green,fg-bold,fg-underline)"},
+		{"attribute cleared", "\x1b[1;32mbold\x1b[22mgreen\x1b[0m", "[bold](fg-green,fg-bold)[green](fg-green)"},
+		{"italic and underline", "\x1b[3;4mslanted\x1b[23mstraight\x1b[0m",
+			"[slanted](fg-underline,fg-italic)[straight](fg-underline)"},
+		{"rgb foreground", "\x1b[38;2;255;0;0mred\x1b[0m", "[red](fg-red,fg-bold)"},
+		{"palette foreground", "\x1b[38;5;21mblue\x1b[0m", "[blue](fg-blue,fg-bold)"},
+		{"palette background", "\x1b[48;5;21mblue\x1b[0m", "[blue](bg-blue,bg-bold)"},
+		{"basic background", "\x1b[37;41mwarning\x1b[49mfg only\x1b[0m", "[warning](fg-white,bg-red)[fg only](fg-white)"},
+		{"rgb background", "\x1b[48;2;0;0;255mblue\x1b[0m", "[blue](bg-blue,bg-bold)"},
+		{"bright colors", "\x1b[92;104mbright\x1b[0m", "[bright](fg-green,fg-bold,bg-blue,bg-bold)"},
+		// Several starts before a reset, which the old regexp couldn't handle
+		{"multiple starts", "\x1b[38;5;226m_ /\"\"\x1b[38;5;196m.-.    \x1b[0m",
+			"[_ /\"\"](fg-yellow,fg-bold)[.-.    ](fg-red,fg-bold)"},
+		{"other escapes dropped", "\x1b[2Kcleared\x1b[32mgreen\x1b[0m", "cleared[green](fg-green)"},
+	}
+
+	for _, test := range tests {
+		if actual := ConvertANSIToColorStrings(test.ansi); actual != test.expected {
+			t.Errorf("%v: got %q, expected %q", test.name, actual, test.expected)
+		}
+	}
+}
+
+func TestSGRStateReset(t *testing.T) {
+	var state SGRState
+
+	state.Apply([]int{1, 3, 4, 31, 42})
+	if state.IsEmpty() {
+		t.Fatal("State is empty after applying attributes")
+	}
+
+	state.Apply([]int{0})
+	if !state.IsEmpty() {
+		t.Errorf("State isn't empty after a reset: %v", state.String())
+	}
+
+	// Attributes after a reset in the same sequence still apply
+	state.Apply([]int{31, 0, 32})
+	if state.String() != "fg-green" {
+		t.Errorf("Got %q after a mid-sequence reset", state.String())
+	}
+}
+
+func TestColor8BitTo4BitGrayscale(t *testing.T) {
+	tests := map[int]int{
+		232: 0,
+		237: 0,
+		238: 8,
+		243: 8,
+		244: 7,
+		249: 7,
+		250: 15,
+		255: 15,
+	}
+
+	for index, expected := range tests {
+		if actual := color8BitTo4Bit(index); actual != expected {
+			t.Errorf("%d: got %d, expected %d", index, actual, expected)
+		}
+	}
+}
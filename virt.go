@@ -0,0 +1,228 @@
+package main
+
+/**
+ * Detects containers, chroots, WSL and virtual machines, so a random container hostname comes with
+ * some idea of what it is
+ */
+
+import (
+	"io/ioutil"
+	"os"
+	"strings"
+
+	"github.com/fatih/color"
+)
+
+type VirtInfo struct {
+	// docker, podman, lxc, systemd-nspawn, kubernetes, chroot, wsl, kvm, vmware, ...
+	Kind string
+
+	// Container or distro name, when we know it
+	Name string
+
+	// True for containers and chroots, false for WSL and VMs
+	Container bool
+}
+
+/**
+ * Values from /run/.containerenv, which podman (and toolbox/distrobox on top of it) writes as
+ * key="value" lines.
+ */
+func readContainerEnv() map[string]string {
+	values := map[string]string{}
+
+	content, err := ioutil.ReadFile("/run/.containerenv")
+	if err != nil {
+		return values
+	}
+
+	for _, line := range strings.Split(string(content), "\n") {
+		parts := strings.SplitN(line, "=", 2)
+		if len(parts) == 2 {
+			values[parts[0]] = strings.Trim(parts[1], "\"")
+		}
+	}
+
+	return values
+}
+
+/**
+ * A variable from pid 1's environment.  Only readable as root or the same user as init, which is
+ * usually the case in a container.
+ */
+func initEnv(name string) string {
+	content, err := ioutil.ReadFile("/proc/1/environ")
+	if err != nil {
+		return ""
+	}
+
+	for _, variable := range strings.Split(string(content), "\x00") {
+		if strings.HasPrefix(variable, name+"=") {
+			return variable[len(name)+1:]
+		}
+	}
+
+	return ""
+}
+
+/**
+ * Whether any of the cgroup paths in /proc/<pid>/cgroup has a component for the name: the name
+ * itself, systemd's "docker-<id>.scope" and "kubepods.slice", or LXC's "lxc.payload.<name>".
+ */
+func cgroupHasComponent(cgroup string, name string) bool {
+	for _, line := range strings.Split(cgroup, "\n") {
+		// hierarchy-ID:controllers:path
+		fields := strings.SplitN(line, ":", 3)
+		if len(fields) != 3 {
+			continue
+		}
+
+		for _, component := range strings.Split(fields[2], "/") {
+			if component == name || strings.HasPrefix(component, name+"-") ||
+				component == name+".slice" || strings.HasPrefix(component, name+".payload.") {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+func detectContainer() *VirtInfo {
+	// Set by toolbox and distrobox
+	name := os.Getenv("CONTAINER_ID")
+
+	if fileExists("/run/.containerenv") {
+		if len(name) == 0 {
+			name = readContainerEnv()["name"]
+		}
+
+		return &VirtInfo{Kind: "podman", Name: name, Container: true}
+	}
+
+	if fileExists("/.dockerenv") {
+		return &VirtInfo{Kind: "docker", Name: name, Container: true}
+	}
+
+	// systemd and nspawn leave this for us, as does "container" in pid 1's environment.  Shells in
+	// toolbox and the like inherit it, so ours will do when we can't read init's.
+	kind := firstNonEmpty(readTrimmed("/run/systemd/container"), initEnv("container"), os.Getenv("container"))
+	if len(kind) > 0 {
+		return &VirtInfo{Kind: kind, Name: name, Container: true}
+	}
+
+	cgroup := readTrimmed("/proc/1/cgroup")
+
+	for _, pattern := range [][2]string{
+		{"kubepods", "kubernetes"},
+		{"docker", "docker"},
+		{"libpod", "podman"},
+		{"lxc", "lxc"},
+		{"cri-containerd", "containerd"},
+	} {
+		if cgroupHasComponent(cgroup, pattern[0]) {
+			return &VirtInfo{Kind: pattern[1], Name: name, Container: true}
+		}
+	}
+
+	return nil
+}
+
+/**
+ * In a chroot our root isn't init's.  Reading /proc/1/root needs root (or the same user as init),
+ * so this only works sometimes.
+ */
+func detectChroot() *VirtInfo {
+	ourRoot, err := os.Stat("/")
+	if err != nil {
+		return nil
+	}
+
+	initRoot, err := os.Stat("/proc/1/root")
+	if err != nil {
+		return nil
+	}
+
+	if os.SameFile(ourRoot, initRoot) {
+		return nil
+	}
+
+	// Debian's schroot tells us which one
+	return &VirtInfo{Kind: "chroot", Name: os.Getenv("SCHROOT_CHROOT_NAME"), Container: true}
+}
+
+func detectWSL() *VirtInfo {
+	distro := os.Getenv("WSL_DISTRO_NAME")
+
+	if len(distro) > 0 || strings.Contains(strings.ToLower(readTrimmed("/proc/sys/kernel/osrelease")), "microsoft") {
+		return &VirtInfo{Kind: "wsl", Name: distro}
+	}
+
+	return nil
+}
+
+/**
+ * Hypervisors, from what they put in the DMI tables.
+ */
+func detectVM() *VirtInfo {
+	vendor := readTrimmed("/sys/class/dmi/id/sys_vendor")
+	product := readTrimmed("/sys/class/dmi/id/product_name")
+	dmi := strings.ToLower(vendor + " " + product)
+
+	for _, pattern := range [][2]string{
+		{"amazon ec2", "ec2"},
+		{"google compute engine", "gce"},
+		{"qemu", "kvm"},
+		{"kvm", "kvm"},
+		{"vmware", "vmware"},
+		{"virtualbox", "virtualbox"},
+		{"parallels", "parallels"},
+		{"xen", "xen"},
+		{"virtual machine", "hyperv"},
+	} {
+		if strings.Contains(dmi, pattern[0]) {
+			return &VirtInfo{Kind: pattern[1]}
+		}
+	}
+
+	return nil
+}
+
+/**
+ * What we're running in, innermost first: a container on a VM is a container.  Nil on bare metal.
+ */
+func NewVirtInfo() *VirtInfo {
+	for _, detect := range []func() *VirtInfo{detectContainer, detectChroot, detectWSL, detectVM} {
+		if info := detect(); info != nil {
+			return info
+		}
+	}
+
+	return nil
+}
+
+/**
+ * Shown after the host, e.g. "⬢podman:dev" or "▣kvm".
+ */
+func virtualization() (string, string, bool) {
+	info := NewVirtInfo()
+
+	if info == nil {
+		return "", "", false
+	}
+
+	icon := "▣"
+	c := themeColor("virt-vm", color.FgBlue)
+
+	if info.Container {
+		icon = "⬢"
+		c = themeColor("virt-container", color.FgHiBlue, color.Bold)
+	}
+
+	str := icon + info.Kind
+	if len(info.Name) > 0 {
+		str += ":" + info.Name
+	}
+
+	return str, c.Sprint(str), info.Container
+}
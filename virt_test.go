@@ -0,0 +1,34 @@
+package main
+
+import (
+	"testing"
+)
+
+func TestCgroupHasComponent(t *testing.T) {
+	tests := []struct {
+		cgroup   string
+		name     string
+		expected bool
+	}{
+		{"12:cpu,cpuacct:/docker/0123abcd", "docker", true},
+		{"0::/system.slice/docker-0123abcd.scope", "docker", true},
+		{"0::/kubepods.slice/kubepods-besteffort.slice/kubepods-besteffort-pod1.slice/cri-containerd-0123.scope", "kubepods", true},
+		{"0::/kubepods/besteffort/pod1/0123abcd", "kubepods", true},
+		{"0::/machine.slice/libpod-0123abcd.scope/container", "libpod", true},
+		{"0::/lxc.payload.dev", "lxc", true},
+		{"4:memory:/lxc/dev", "lxc", true},
+		{"0::/system.slice/cri-containerd-0123.scope", "cri-containerd", true},
+		// Just mentioning the name isn't enough
+		{"0::/init.scope", "docker", false},
+		{"0::/user.slice/user-1000.slice/session-2.scope/mydockerapp", "docker", false},
+		{"0::/system.slice/lxcfs.service", "lxc", false},
+		{"0::/system.slice/containerd.service", "cri-containerd", false},
+		{"docker", "docker", false},
+	}
+
+	for _, test := range tests {
+		if actual := cgroupHasComponent(test.cgroup, test.name); actual != test.expected {
+			t.Errorf("%q has %q: got %v, expected %v", test.cgroup, test.name, actual, test.expected)
+		}
+	}
+}
@@ -0,0 +1,88 @@
+package main
+
+/**
+ * Display width of strings on the terminal
+ */
+
+import (
+	"unicode"
+
+	"github.com/mattn/go-runewidth"
+)
+
+// How many columns "ambiguous" East Asian characters take up (1 or 2).  Depends on the terminal and font.
+var AMBIGUOUS_WIDTH = 1
+
+var WIDTH_CONDITION = newWidthCondition(AMBIGUOUS_WIDTH)
+
+func newWidthCondition(ambiguousWidth int) *runewidth.Condition {
+	condition := runewidth.NewCondition()
+	condition.EastAsianWidth = ambiguousWidth == 2
+	return condition
+}
+
+/**
+ * Sets how wide ambiguous characters are.  Anything other than 2 is treated as 1.
+ */
+func setAmbiguousWidth(ambiguousWidth int) {
+	if ambiguousWidth != 2 {
+		ambiguousWidth = 1
+	}
+
+	AMBIGUOUS_WIDTH = ambiguousWidth
+	WIDTH_CONDITION = newWidthCondition(ambiguousWidth)
+}
+
+/**
+ * How many terminal columns a string takes up.
+ *
+ * Ignores ANSI escapes, counts wide (CJK, most emoji) characters as two columns, zero-width characters as
+ * nothing, and treats grapheme clusters (ZWJ emoji sequences, combining marks) as a single character.
+ */
+func displayWidth(str string) int {
+	return WIDTH_CONDITION.StringWidth(stripANSI(str))
+}
+
+/**
+ * Drops the first character, along with anything that's part of it: combining marks, variation
+ * selectors, skin tones, and characters joined on with a ZWJ.
+ */
+func dropFirstCharacter(runes []rune) []rune {
+	runes = runes[1:]
+
+	for len(runes) > 0 {
+		r := runes[0]
+
+		if r == '\u200d' {
+			// The joiner and the character it joins
+			runes = runes[1:]
+			if len(runes) > 0 {
+				runes = runes[1:]
+			}
+		} else if unicode.In(r, unicode.Mn, unicode.Me, unicode.Variation_Selector) || (r >= 0x1F3FB && r <= 0x1F3FF) {
+			runes = runes[1:]
+		} else {
+			break
+		}
+	}
+
+	return runes
+}
+
+/**
+ * Cuts characters off the start of a string until it fits in the given width.
+ * Never splits a wide character or a grapheme cluster, so the result may be narrower than requested.
+ */
+func trimStartToWidth(str string, width int) string {
+	if width <= 0 {
+		return ""
+	}
+
+	runes := []rune(str)
+
+	for len(runes) > 0 && WIDTH_CONDITION.StringWidth(string(runes)) > width {
+		runes = dropFirstCharacter(runes)
+	}
+
+	return string(runes)
+}
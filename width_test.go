@@ -0,0 +1,77 @@
+package main
+
+import (
+	"testing"
+)
+
+func TestDisplayWidth(t *testing.T) {
+	defer setAmbiguousWidth(AMBIGUOUS_WIDTH)
+
+	tests := []struct {
+		name      string
+		str       string
+		width     int
+		ambiWidth int
+	}{
+		{"ascii", "abc", 3, 1},
+		{"empty", "", 0, 1},
+		{"escapes ignored", "\x1b[31m~/src\x1b[0m", 5, 1},
+		{"cjk", "日本語", 6, 1},
+		{"hangul", "한국어", 6, 1},
+		{"cjk with escapes", "\x1b[1m日本\x1b[0m", 4, 1},
+		{"emoji", "👍", 2, 1},
+		{"zwj family", "👨\u200d👩\u200d👧", 2, 1},
+		{"zwj flag", "🏳\ufe0f\u200d🌈", 2, 1},
+		{"skin tone", "👍\U0001F3FD", 2, 1},
+		{"combining mark", "e\u0301e\u0301", 2, 1},
+		{"zero width space", "a\u200bb", 2, 1},
+		{"ambiguous narrow", "±→…", 3, 1},
+		{"ambiguous wide", "±→…", 6, 2},
+		{"precomposed ambiguous", "é", 2, 2},
+		{"cjk unaffected by ambiwidth", "日本語", 6, 2},
+	}
+
+	for _, test := range tests {
+		setAmbiguousWidth(test.ambiWidth)
+
+		if actual := displayWidth(test.str); actual != test.width {
+			t.Errorf("%v: got %d, expected %d", test.name, actual, test.width)
+		}
+	}
+}
+
+func TestTrimStartToWidth(t *testing.T) {
+	defer setAmbiguousWidth(AMBIGUOUS_WIDTH)
+
+	tests := []struct {
+		name      string
+		str       string
+		width     int
+		ambiWidth int
+		expected  string
+	}{
+		{"fits", "~/src", 5, 1, "~/src"},
+		{"ascii", "~/src/prompt", 6, 1, "prompt"},
+		{"zero width", "abc", 0, 1, ""},
+		{"cjk", "日本語", 4, 1, "本語"},
+		// Half of 日 won't fit, so it's one column short
+		{"would split a wide rune", "日本語", 5, 1, "本語"},
+		{"wide after narrow", "a日本", 3, 1, "本"},
+		{"zwj sequence kept whole", "a👨\u200d👩\u200d👧", 2, 1, "👨\u200d👩\u200d👧"},
+		{"zwj sequence dropped whole", "👨\u200d👩\u200d👧x", 2, 1, "x"},
+		{"flag dropped whole", "🏳\ufe0f\u200d🌈x", 1, 1, "x"},
+		{"skin tone dropped with its emoji", "👍\U0001F3FDx", 1, 1, "x"},
+		{"combining mark dropped with its letter", "e\u0301e\u0301", 1, 1, "e\u0301"},
+		{"ambiguous narrow", "→…x", 2, 1, "…x"},
+		{"ambiguous wide", "→…x", 3, 2, "…x"},
+		{"ambiguous wide would split", "→…x", 4, 2, "…x"},
+	}
+
+	for _, test := range tests {
+		setAmbiguousWidth(test.ambiWidth)
+
+		if actual := trimStartToWidth(test.str, test.width); actual != test.expected {
+			t.Errorf("%v: got %q, expected %q", test.name, actual, test.expected)
+		}
+	}
+}
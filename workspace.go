@@ -0,0 +1,114 @@
+package main
+
+/**
+ * Workspaces: a directory of packages (Brazil style by default), so deep paths inside them can be
+ * shown relative to the package instead
+ */
+
+import (
+	"path/filepath"
+	"strings"
+
+	"github.com/fatih/color"
+)
+
+// Files or directories at the top of a workspace, override with ~/.host/config/workspace_markers
+var DEFAULT_WORKSPACE_MARKERS = []string{"packageInfo"}
+
+// Files or directories at the top of a package, override with ~/.host/config/package_markers
+var DEFAULT_PACKAGE_MARKERS = []string{"Config"}
+
+type WorkspaceInfo struct {
+	Root string
+	Name string
+
+	// Empty when we're in the workspace but not in a package
+	Package     string
+	PackageRoot string
+}
+
+func markers(name string, defaults []string) []string {
+	markers := readHostConfigLines(name)
+	if len(markers) == 0 {
+		markers = defaults
+	}
+
+	return markers
+}
+
+/**
+ * Finds the workspace and package we're in, or nil if we're not in one.
+ */
+func NewWorkspaceInfo(dir string) *WorkspaceInfo {
+	marker := findUpwards(dir, markers("workspace_markers", DEFAULT_WORKSPACE_MARKERS)...)
+
+	if len(marker) == 0 {
+		return nil
+	}
+
+	info := &WorkspaceInfo{Root: filepath.Dir(marker)}
+	info.Name = filepath.Base(info.Root)
+
+	// The closest package between here and the workspace root
+	packageMarkers := markers("package_markers", DEFAULT_PACKAGE_MARKERS)
+
+	for current := dir; current != info.Root && strings.HasPrefix(current, info.Root); current = filepath.Dir(current) {
+		for _, packageMarker := range packageMarkers {
+			if fileExists(filepath.Join(current, packageMarker)) {
+				info.Package = filepath.Base(current)
+				info.PackageRoot = current
+				return info
+			}
+		}
+	}
+
+	return info
+}
+
+// Loaded on first use
+var WORKSPACE *WorkspaceInfo
+var WORKSPACE_LOADED bool
+
+func currentWorkspace() *WorkspaceInfo {
+	if !WORKSPACE_LOADED && WORKING_DIRECTORY != "" {
+		WORKSPACE = NewWorkspaceInfo(WORKING_DIRECTORY)
+		WORKSPACE_LOADED = true
+	}
+
+	return WORKSPACE
+}
+
+/**
+ * Where we are relative to the package (or the workspace, outside of a package), "." at the top.
+ */
+func (w *WorkspaceInfo) RelativePath(dir string) string {
+	base := w.Root
+	if len(w.PackageRoot) > 0 {
+		base = w.PackageRoot
+	}
+
+	relative, err := filepath.Rel(base, dir)
+	if err != nil {
+		return dir
+	}
+
+	return relative
+}
+
+/**
+ * Shows "workspace:package", or just the workspace outside of a package.
+ */
+func workspace() (string, string) {
+	info := currentWorkspace()
+
+	if info == nil {
+		return "", ""
+	}
+
+	str := info.Name
+	if len(info.Package) > 0 {
+		str += ":" + info.Package
+	}
+
+	return str, themeColor("workspace", color.FgHiCyan).Sprint(str)
+}